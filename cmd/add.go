@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pquerna/otp"
+	"github.com/spf13/cobra"
+
+	"bksworm/totpcli/totpdb"
+)
+
+const (
+	FLAG_TYPE    = "type"
+	FLAG_COUNTER = "counter"
+)
+
+var cmdAdd = &cobra.Command{
+	Use:   "add",
+	Short: "Add a new TOTP from its secret",
+	Long: `Add a new TOTP from the base32 secret services show as "can't scan? enter this key".
+Spaces, lower case and missing padding in the secret are tolerated. Without flag
+"secret", or with "--secret -", it is prompted for without echo or read from standard
+input if that is not a terminal.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		flags := cmd.Flags()
+		var ent totpdb.TOTPEntry
+		ent.Issuer, _ = flags.GetString(FLAG_ISSUER)
+		ent.AccountName, _ = flags.GetString(FLAG_ACCOUNT)
+		ent.Type, _ = flags.GetString(FLAG_TYPE)
+		ent.Digits, _ = flags.GetInt(FLAG_DIGITS)
+		ent.Period, _ = flags.GetUint64(FLAG_PERIOD)
+		ent.Algorithm, _ = flags.GetString(FLAG_ALGORITHM)
+		ent.Counter, _ = flags.GetUint64(FLAG_COUNTER)
+
+		secret, ok, err := getSecretFlag(cmd)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if secret, err = readSecret(); err != nil {
+				return err
+			}
+		}
+		ent.Secret = secret
+
+		key, err := totpdb.NewKey(ent)
+		if err != nil {
+			return fmt.Errorf("error adding for %s from %s: %w", ent.AccountName, ent.Issuer, err)
+		}
+
+		db, err := openDB(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.close()
+
+		warnKey(cmd, key)
+		if err := db.data.AddEntry(key); err != nil {
+			return fmt.Errorf("error adding for %s from %s: %w", key.AccountName(), key.Issuer(), err)
+		}
+		if err := db.save(); err != nil {
+			return err
+		}
+
+		return showAdded(cmd, db.data, key)
+	},
+}
+
+// showAdded reports the entry of the key just added with its first code, to compare
+// with the service. HOTP entries are shown without a code, which would use up their counter.
+func showAdded(cmd *cobra.Command, data *totpdb.TOTPData, key *otp.Key) error {
+	quiet := getQuiet(cmd)
+	conditionalPrintf(quiet, "Added TOTP for %s from %s\n", key.AccountName(), key.Issuer())
+	added, err := data.GetEntry(key.AccountName(), key.Issuer())
+	if err != nil {
+		return err
+	}
+	format := getOutput(cmd)
+	if added.Type != totpdb.TypeTOTP {
+		if format != totpdb.FormatTable {
+			return totpdb.WriteEntry(os.Stdout, format, added.Info(), totpdb.ListOptions{})
+		}
+		return nil
+	}
+	// Show the first code to compare with the service
+	if format != totpdb.FormatTable {
+		return writeCode(cmd, data, added, data.Now())
+	}
+	code, err := data.GenerateCode(added, data.Now())
+	if err != nil {
+		return fmt.Errorf("error generating TOTP code: %w", err)
+	}
+	conditionalPrintf(quiet, "Generated TOTP code: ")
+	fmt.Println(code)
+	return nil
+}
+
+// warnKey prints the warnings about the parameters of a key to be added, see totpdb.ValidateKey.
+// Errors are left to AddEntry.
+func warnKey(cmd *cobra.Command, key *otp.Key) {
+	_, issues := totpdb.ValidateKey(key)
+	warnIssues(cmd, issues)
+}
+
+// warnIssues prints the warnings among the issues found by totpdb.ValidateEntry.
+func warnIssues(cmd *cobra.Command, issues []totpdb.EntryIssue) {
+	if quiet, _ := cmd.Flags().GetBool(FLAG_QUIET); quiet {
+		return
+	}
+	for _, iss := range issues {
+		if iss.Warning {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", iss)
+		}
+	}
+}
+
+func setAddCommands() {
+	cmdAdd.Flags().StringP(FLAG_ISSUER, "i", "", "Issuer name")
+	cmdAdd.Flags().StringP(FLAG_ACCOUNT, "a", "", "Account name")
+	cmdAdd.MarkFlagRequired(FLAG_ACCOUNT)
+	cmdAdd.Flags().String(FLAG_SECRET, "", "Base32 secret, prompted for or read from standard input without it")
+	cmdAdd.Flags().String(FLAG_TYPE, totpdb.TypeTOTP, "OTP type: totp or hotp")
+	cmdAdd.Flags().Int(FLAG_DIGITS, 6, "Number of digits")
+	cmdAdd.Flags().Uint64(FLAG_PERIOD, 30, "Period in seconds")
+	cmdAdd.Flags().String(FLAG_ALGORITHM, "SHA1", "Algorithm: SHA1, SHA256 or SHA512")
+	cmdAdd.Flags().Uint64(FLAG_COUNTER, 0, "Initial counter of HOTP entries")
+}
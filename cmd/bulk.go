@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"bksworm/totpcli/totpdb"
+)
+
+const (
+	FLAG_ALL_FROM_ISSUER = "all-from-issuer"
+	FLAG_YES             = "yes"
+)
+
+// bulkFlags select several entries at once, see getBulkQuery.
+var bulkFlags = []string{FLAG_FILTER, FLAG_TAG, FLAG_GROUP, FLAG_ALL_FROM_ISSUER}
+
+// isBulk reports whether any flag selecting several entries is given.
+func isBulk(cmd *cobra.Command) bool {
+	for _, name := range bulkFlags {
+		if cmd.Flags().Changed(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkBulkFlags rejects the flags that sort and limit the selected entries
+// without a flag selecting several entries, as they would be ignored.
+func checkBulkFlags(cmd *cobra.Command) error {
+	if isBulk(cmd) {
+		return nil
+	}
+	for _, name := range []string{FLAG_SORT, FLAG_LIMIT} {
+		if cmd.Flags().Changed(name) {
+			return fmt.Errorf("flag --%s needs one of --%s", name, strings.Join(bulkFlags, ", --"))
+		}
+	}
+	return nil
+}
+
+// getBulkQuery returns the query given by the query flags and flag "all-from-issuer".
+func getBulkQuery(cmd *cobra.Command) (totpdb.Query, error) {
+	q, err := getQuery(cmd)
+	if err != nil {
+		return q, err
+	}
+	if cmd.Flags().Changed(FLAG_ALL_FROM_ISSUER) {
+		issuer, _ := cmd.Flags().GetString(FLAG_ALL_FROM_ISSUER)
+		q.Filters = append(q.Filters, totpdb.Filter{Field: "issuer", Op: totpdb.OpEqual, Value: issuer})
+	}
+	return q, nil
+}
+
+// setBulkFlags adds the flags that select several entries to a command that
+// otherwise works on the single entry selected by setEntryFlags.
+func setBulkFlags(cmd *cobra.Command, action string) {
+	setQueryFlags(cmd, action)
+	cmd.Flags().String(FLAG_ALL_FROM_ISSUER, "", "Select all TOTPs of this issuer to "+action)
+	cmd.Flags().BoolP(FLAG_YES, "y", false, "Do not ask for confirmation")
+	for _, name := range bulkFlags {
+		cmd.MarkFlagsMutuallyExclusive(FLAG_ID, name)
+		cmd.MarkFlagsMutuallyExclusive(FLAG_ACCOUNT, name)
+	}
+}
+
+// confirm shows the entries affected by a bulk operation and asks whether to go on,
+// unless flag "yes" is given. Without a terminal to ask on, it fails instead.
+// With flags "yes" and "quiet" the entries are not shown either.
+func confirm(cmd *cobra.Command, infos []totpdb.EntryInfo, opts totpdb.ListOptions, question string) (bool, error) {
+	yes, _ := cmd.Flags().GetBool(FLAG_YES)
+	quiet, _ := cmd.Flags().GetBool(FLAG_QUIET)
+	if !yes || !quiet {
+		if err := totpdb.WriteEntries(os.Stdout, getOutput(cmd), infos, opts); err != nil {
+			return false, err
+		}
+	}
+
+	if yes {
+		return true, nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, fmt.Errorf("standard input is not a terminal to confirm on, use --%s", FLAG_YES)
+	}
+	fmt.Fprintf(os.Stderr, "%s [y/N]: ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// removeSelected moves all entries selected by the bulk flags to the trash after
+// confirmation, writing the database once.
+func removeSelected(cmd *cobra.Command, db *dbSession) error {
+	q, err := getBulkQuery(cmd)
+	if err != nil {
+		return fmt.Errorf("error removing TOTPs: %w", err)
+	}
+	selected, err := db.data.Select(q)
+	if err != nil {
+		return fmt.Errorf("error removing TOTPs: %w", err)
+	}
+	if len(selected) == 0 {
+		return fmt.Errorf("error removing TOTPs: %w", totpdb.ErrEntryNotFound)
+	}
+
+	infos := make([]totpdb.EntryInfo, len(selected))
+	for i, ind := range selected {
+		infos[i] = db.data.Entries[ind].Info()
+	}
+	ok, err := confirm(cmd, infos, totpdb.ListOptions{}, fmt.Sprintf("Move %d TOTPs to the trash?", len(selected)))
+	if err != nil {
+		return err
+	}
+	quiet := getQuiet(cmd)
+	if !ok {
+		conditionalPrintf(quiet, "Nothing removed\n")
+		return nil
+	}
+
+	removed, err := db.data.RemoveEntries(selected)
+	if err != nil {
+		return fmt.Errorf("error removing TOTPs: %w", err)
+	}
+	if err := db.save(); err != nil {
+		return err
+	}
+	conditionalPrintf(quiet, "Moved %d TOTPs to the trash\n", len(removed))
+	return nil
+}
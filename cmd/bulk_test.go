@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestCheckBulkFlags(t *testing.T) {
+	tests := []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"-a", "alice"}, true},
+		{[]string{"--tag", "work", "--sort", "used", "--limit", "2"}, true},
+		{[]string{"--all-from-issuer", "ACME", "--limit", "1"}, true},
+		// Sorting and limiting a single entry would be ignored
+		{[]string{"-a", "alice", "--limit", "1"}, false},
+		{[]string{"--id", "1f0c", "--sort", "issuer"}, false},
+	}
+	for _, tt := range tests {
+		cmd := &cobra.Command{}
+		setEntryFlags(cmd, "remove")
+		setBulkFlags(cmd, "remove")
+		if err := cmd.ParseFlags(tt.args); err != nil {
+			t.Fatalf("%q: %v", tt.args, err)
+		}
+		if err := checkBulkFlags(cmd); (err == nil) != tt.ok {
+			t.Errorf("%q: got error %v", tt.args, err)
+		}
+	}
+}
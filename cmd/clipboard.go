@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/atotto/clipboard"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	FLAG_CLEAR_AFTER = "clear-after"
+	FLAG_SELECTION   = "selection"
+)
+
+const (
+	selectionClipboard = "clipboard"
+	selectionPrimary   = "primary"
+)
+
+// clipboardBackend reads, writes and clears the clipboard or the primary selection.
+type clipboardBackend interface {
+	Read() (string, error)
+	Write(text string) error
+	Clear() error
+}
+
+// systemClipboard uses xclip or xsel on X11 and the native clipboard elsewhere.
+type systemClipboard struct {
+	primary bool
+}
+
+func (c systemClipboard) Read() (string, error) {
+	clipboard.Primary = c.primary
+	return clipboard.ReadAll()
+}
+
+func (c systemClipboard) Write(text string) error {
+	clipboard.Primary = c.primary
+	return clipboard.WriteAll(text)
+}
+
+func (c systemClipboard) Clear() error {
+	return c.Write("")
+}
+
+// wlClipboard uses wl-copy and wl-paste on Wayland.
+type wlClipboard struct {
+	primary bool
+}
+
+// args adds the flag for the primary selection to the arguments of wl-copy or wl-paste.
+func (c wlClipboard) args(args ...string) []string {
+	if c.primary {
+		args = append(args, "--primary")
+	}
+	return args
+}
+
+func (c wlClipboard) Read() (string, error) {
+	out, err := exec.Command("wl-paste", c.args("--no-newline")...).Output()
+	return string(out), err
+}
+
+func (c wlClipboard) Write(text string) error {
+	cmd := exec.Command("wl-copy", c.args()...)
+	cmd.Stdin = strings.NewReader(text)
+	return cmd.Run()
+}
+
+func (c wlClipboard) Clear() error {
+	return exec.Command("wl-copy", c.args("--clear")...).Run()
+}
+
+// newClipboard returns the backend for the selection; tests replace it.
+var newClipboard = findClipboard
+
+// findClipboard returns the backend for the clipboard or the primary selection,
+// wl-clipboard on Wayland if it is installed.
+func findClipboard(selection string) (clipboardBackend, error) {
+	var primary bool
+	switch selection {
+	case selectionClipboard:
+	case selectionPrimary:
+		primary = true
+	default:
+		return nil, fmt.Errorf("unknown selection %q, must be %s or %s", selection, selectionClipboard, selectionPrimary)
+	}
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		if _, err := exec.LookPath("wl-copy"); err == nil {
+			return wlClipboard{primary: primary}, nil
+		}
+	}
+	return systemClipboard{primary: primary}, nil
+}
+
+// copyCode copies the code to the selection and, unless clearAfter is zero, starts
+// a detached helper that clears the selection after that time if it still holds the code.
+func copyCode(code, selection string, clearAfter time.Duration) error {
+	cb, err := newClipboard(selection)
+	if err != nil {
+		return err
+	}
+	if err := cb.Write(code); err != nil {
+		return fmt.Errorf("error writing to clipboard: %w", err)
+	}
+	if clearAfter <= 0 {
+		return nil
+	}
+	if err := startClearHelper(code, selection, clearAfter); err != nil {
+		return fmt.Errorf("error starting clipboard clear: %w", err)
+	}
+	return nil
+}
+
+// startClearHelper runs cmdClearClipboard in the background, surviving the exit of this process.
+// The code is passed on stdin to keep it out of the process list.
+func startClearHelper(code, selection string, clearAfter time.Duration) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	// The code fits into the pipe buffer, so it can be written before the helper runs
+	_, err = io.WriteString(w, code)
+	w.Close()
+	if err != nil {
+		return err
+	}
+
+	helper := exec.Command(exe, cmdClearClipboard.Name(),
+		"--"+FLAG_CLEAR_AFTER, clearAfter.String(), "--"+FLAG_SELECTION, selection)
+	helper.Stdin = r
+	detachProcess(helper)
+	if err := helper.Start(); err != nil {
+		return err
+	}
+	return helper.Process.Release()
+}
+
+var cmdClearClipboard = &cobra.Command{
+	Use:    "clear-clipboard",
+	Short:  "Clear the clipboard after a time if it still holds the code read from stdin",
+	Hidden: true,
+	Args:   cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		clearAfter, _ := cmd.Flags().GetDuration(FLAG_CLEAR_AFTER)
+		selection, _ := cmd.Flags().GetString(FLAG_SELECTION)
+		code, err := io.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return err
+		}
+		cb, err := newClipboard(selection)
+		if err != nil {
+			return err
+		}
+
+		time.Sleep(clearAfter)
+		return clearIfUnchanged(cb, string(code))
+	},
+}
+
+// clearIfUnchanged clears the selection if it still holds the code,
+// leaving anything copied since alone.
+func clearIfUnchanged(cb clipboardBackend, code string) error {
+	current, err := cb.Read()
+	if err != nil || current != code {
+		return err
+	}
+	return cb.Clear()
+}
+
+// getClearAfter returns the time after which copied codes are cleared, set by flag
+// "clear-after" or environment variable TOTP_CLEAR_AFTER; zero keeps them.
+func getClearAfter() (time.Duration, error) {
+	clearAfter := viper.GetString(FLAG_CLEAR_AFTER)
+	if clearAfter == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(clearAfter)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing clear-after %q: %w", clearAfter, err)
+	}
+	return d, nil
+}
+
+func setClipboardCommands() {
+	cmdClearClipboard.Flags().Duration(FLAG_CLEAR_AFTER, 0, "Time to wait before clearing")
+	cmdClearClipboard.Flags().String(FLAG_SELECTION, selectionClipboard, "Selection to clear: clipboard or primary")
+
+	cmdGenerate.Flags().String(FLAG_CLEAR_AFTER, "", "Clear the clipboard after this time, e.g. 30s, if it still holds the code; if not set in, environment variable TOTP_CLEAR_AFTER")
+	viper.BindPFlag(FLAG_CLEAR_AFTER, cmdGenerate.Flags().Lookup(FLAG_CLEAR_AFTER))
+	viper.SetDefault(FLAG_CLEAR_AFTER, os.Getenv("TOTP_CLEAR_AFTER"))
+	cmdGenerate.Flags().String(FLAG_SELECTION, selectionClipboard, "Selection to copy the code to with flag \"clipboard\": clipboard or primary")
+}
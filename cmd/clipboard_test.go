@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// memClipboard holds the selection in memory.
+type memClipboard struct {
+	text    string
+	cleared bool
+	err     error
+}
+
+func (c *memClipboard) Read() (string, error) { return c.text, c.err }
+
+func (c *memClipboard) Write(text string) error {
+	if c.err != nil {
+		return c.err
+	}
+	c.text = text
+	return nil
+}
+
+func (c *memClipboard) Clear() error {
+	c.text, c.cleared = "", true
+	return c.err
+}
+
+func TestCopyCode(t *testing.T) {
+	var cb memClipboard
+	var selection string
+	defer func(orig func(string) (clipboardBackend, error)) { newClipboard = orig }(newClipboard)
+	newClipboard = func(s string) (clipboardBackend, error) {
+		selection = s
+		return &cb, nil
+	}
+
+	// Without clear-after no helper is started
+	if err := copyCode("123456", selectionPrimary, 0); err != nil {
+		t.Fatal(err)
+	}
+	if cb.text != "123456" || selection != selectionPrimary {
+		t.Errorf("copied %q to %s", cb.text, selection)
+	}
+
+	cb.err = errors.New("no display")
+	if err := copyCode("123456", selectionClipboard, 0); err == nil || !strings.Contains(err.Error(), "no display") {
+		t.Errorf("got error %v", err)
+	}
+}
+
+func TestClearIfUnchanged(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		cleared bool
+	}{
+		{"still holds the code", "123456", true},
+		{"copied since", "something else", false},
+		{"cleared since", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cb := memClipboard{text: tt.current}
+			if err := clearIfUnchanged(&cb, "123456"); err != nil {
+				t.Fatal(err)
+			}
+			if cb.cleared != tt.cleared {
+				t.Errorf("got cleared %t, want %t", cb.cleared, tt.cleared)
+			}
+			if !tt.cleared && cb.text != tt.current {
+				t.Errorf("got %q, want %q left alone", cb.text, tt.current)
+			}
+		})
+	}
+
+	cb := memClipboard{text: "123456", err: errors.New("no display")}
+	if err := clearIfUnchanged(&cb, "123456"); err == nil || cb.cleared {
+		t.Errorf("got error %v and cleared %t when the selection can not be read", err, cb.cleared)
+	}
+}
+
+func TestFindClipboard(t *testing.T) {
+	fakeTools(t, "wl-copy")
+	t.Setenv("WAYLAND_DISPLAY", "wayland-0")
+	if cb, err := findClipboard(selectionPrimary); err != nil || cb != (wlClipboard{primary: true}) {
+		t.Errorf("got %#v, %v on Wayland", cb, err)
+	}
+	t.Setenv("WAYLAND_DISPLAY", "")
+	if cb, err := findClipboard(selectionClipboard); err != nil || cb != (systemClipboard{}) {
+		t.Errorf("got %#v, %v on X11", cb, err)
+	}
+	if _, err := findClipboard("secondary"); err == nil {
+		t.Error("expected an error for an unknown selection")
+	}
+}
+
+func TestWlClipboardClear(t *testing.T) {
+	tests := []struct {
+		primary bool
+		want    []string
+	}{
+		{false, []string{"--clear"}},
+		{true, []string{"--clear", "--primary"}},
+	}
+	for _, tt := range tests {
+		dir := fakeTools(t, "wl-copy")
+		if err := (wlClipboard{primary: tt.primary}).Clear(); err != nil {
+			t.Fatal(err)
+		}
+		if got := toolArgs(t, dir, "wl-copy"); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("primary=%t: got arguments %q, want %q", tt.primary, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"bksworm/totpcli/totpdb"
+)
+
+const (
+	FLAG_AT           = "at"
+	FLAG_OFFSET       = "offset"
+	FLAG_SKEW         = "skew"
+	FLAG_MIN_VALIDITY = "min-validity"
+	FLAG_SERVER       = "server"
+	FLAG_SAVE         = "save"
+	FLAG_TIMEOUT      = "timeout"
+)
+
+// clockResult is the result of "clock check" in machine-readable formats.
+type clockResult struct {
+	Server    string  `json:"server" yaml:"server"`
+	Offset    float64 `json:"offset_seconds" yaml:"offset_seconds"`
+	RoundTrip float64 `json:"round_trip_seconds" yaml:"round_trip_seconds"`
+	Saved     bool    `json:"saved" yaml:"saved"`
+}
+
+// skewResult is the result of "clock skew" in machine-readable formats.
+type skewResult struct {
+	Skew float64 `json:"skew_seconds" yaml:"skew_seconds"`
+}
+
+var cmdClock = &cobra.Command{
+	Use:   "clock",
+	Short: "Show or correct the clock codes are generated for",
+	Long: `Codes are generated for the system time corrected by the clock skew stored in
+the database, so that machines with a wrong clock still generate valid codes.`,
+}
+
+var cmdClockSkew = &cobra.Command{
+	Use:   "skew [DURATION]",
+	Short: "Show or set the correction of the system clock",
+	Long: `Show or set the correction added to the system clock when generating and
+verifying codes, e.g. "30s" if the clock is 30 seconds behind or "-1m" if it is a
+minute ahead. "0" removes the correction.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openDB(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.close()
+
+		format := getOutput(cmd)
+		if len(args) == 0 {
+			if format != totpdb.FormatTable {
+				return totpdb.WriteValue(os.Stdout, format, skewResult{Skew: db.data.ClockSkew.Seconds()})
+			}
+			fmt.Println(db.data.ClockSkew)
+			return nil
+		}
+		skew, err := time.ParseDuration(args[0])
+		if err != nil {
+			return fmt.Errorf("error setting clock skew: %w", err)
+		}
+		db.data.ClockSkew = skew
+		if err := db.save(); err != nil {
+			return err
+		}
+		if format != totpdb.FormatTable {
+			return totpdb.WriteValue(os.Stdout, format, skewResult{Skew: skew.Seconds()})
+		}
+		conditionalPrintf(getQuiet(cmd), "Codes are generated for the system time corrected by %s\n", skew)
+		return nil
+	},
+}
+
+var cmdClockCheck = &cobra.Command{
+	Use:   "check",
+	Short: "Compare the system clock with an NTP server",
+	Long: `Query an NTP server and report how far the system clock is off, the most common
+reason for rejected codes. The server is set by flag "server" or environment variable
+TOTP_NTP_SERVER and defaults to pool.ntp.org. With flag "save" the offset is stored
+as the clock skew, so that codes are generated for the corrected time.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		server := viper.GetString(FLAG_SERVER)
+		timeout, _ := cmd.Flags().GetDuration(FLAG_TIMEOUT)
+		save, _ := cmd.Flags().GetBool(FLAG_SAVE)
+
+		check, err := totpdb.CheckClock(server, timeout)
+		if err != nil {
+			return fmt.Errorf("error querying NTP server %s: %w", check.Server, err)
+		}
+		offset := check.Offset.Round(time.Millisecond)
+
+		if save {
+			db, err := openDB(cmd)
+			if err != nil {
+				return err
+			}
+			defer db.close()
+			db.data.ClockSkew = offset
+			if err := db.save(); err != nil {
+				return err
+			}
+		}
+
+		format := getOutput(cmd)
+		if format != totpdb.FormatTable {
+			return totpdb.WriteValue(os.Stdout, format, clockResult{
+				Server:    check.Server,
+				Offset:    offset.Seconds(),
+				RoundTrip: check.RoundTrip.Seconds(),
+				Saved:     save,
+			})
+		}
+		quiet := getQuiet(cmd)
+		switch {
+		case offset > 0:
+			conditionalPrintf(quiet, "The system clock is %s behind %s\n", offset, check.Server)
+		case offset < 0:
+			conditionalPrintf(quiet, "The system clock is %s ahead of %s\n", -offset, check.Server)
+		default:
+			conditionalPrintf(quiet, "The system clock agrees with %s\n", check.Server)
+		}
+		conditionalPrintf(quiet, "Round trip: %s\n", check.RoundTrip.Round(time.Microsecond))
+		if save {
+			conditionalPrintf(quiet, "Codes are generated for the system time corrected by %s\n", offset)
+		} else if offset.Abs() >= time.Second {
+			conditionalPrintf(quiet, "Run with --save to correct codes for the offset\n")
+		}
+		return nil
+	},
+}
+
+// getCodeTime returns the time to generate codes for given by flags "at", "offset" and "skew",
+// the system time corrected by the clock skew of the database by default.
+func getCodeTime(cmd *cobra.Command, data *totpdb.TOTPData) (time.Time, error) {
+	flags := cmd.Flags()
+	offset, _ := flags.GetDuration(FLAG_OFFSET)
+	if at, _ := flags.GetString(FLAG_AT); at != "" {
+		t, err := parseTime(at)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("error parsing time %q: %w", at, err)
+		}
+		return t.Add(offset), nil
+	}
+	t := data.Now()
+	if flags.Changed(FLAG_SKEW) {
+		skew, _ := flags.GetDuration(FLAG_SKEW)
+		t = time.Now().Add(skew)
+	}
+	return t.Add(offset), nil
+}
+
+// parseTime parses a time in RFC 3339 format or as Unix seconds.
+func parseTime(s string) (time.Time, error) {
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func setClockCommands() {
+	cmdClock.AddCommand(cmdClockSkew, cmdClockCheck)
+	cmdClockCheck.Flags().String(FLAG_SERVER, "", "NTP server as host or host:port, if not set in, environment variable TOTP_NTP_SERVER or pool.ntp.org")
+	viper.BindPFlag(FLAG_SERVER, cmdClockCheck.Flags().Lookup(FLAG_SERVER))
+	viper.SetDefault(FLAG_SERVER, os.Getenv("TOTP_NTP_SERVER"))
+	cmdClockCheck.Flags().Duration(FLAG_TIMEOUT, 5*time.Second, "Time to wait for the answer of the server")
+	cmdClockCheck.Flags().Bool(FLAG_SAVE, false, "Store the offset as the clock skew")
+
+	cmdGenerate.Flags().String(FLAG_AT, "", "Generate the code for a time in RFC 3339 format or as Unix seconds instead of now")
+	cmdGenerate.Flags().Duration(FLAG_OFFSET, 0, "Generate the code for the time shifted by a duration, e.g. -30s or 5m")
+	cmdGenerate.Flags().Int(FLAG_NEXT, 0, "Also generate the codes of the next N time steps")
+	cmdGenerate.Flags().Duration(FLAG_SKEW, 0, `Correction of the system clock instead of the one set by "clock skew"`)
+	cmdGenerate.Flags().Duration(FLAG_MIN_VALIDITY, 0, "Wait for the next period if the code expires sooner, e.g. 5s")
+	cmdGenerate.MarkFlagsMutuallyExclusive(FLAG_AT, FLAG_SKEW)
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"1111111109", 1111111109},
+		{"0", 0},
+		{"-30", -30},
+		{"2005-03-18T01:58:29Z", 1111111109},
+		{"2005-03-18T02:58:29+01:00", 1111111109},
+	}
+	for _, tt := range tests {
+		got, err := parseTime(tt.in)
+		if err != nil {
+			t.Errorf("%q: %v", tt.in, err)
+			continue
+		}
+		if got.Unix() != tt.want {
+			t.Errorf("%q: got %d, want %d", tt.in, got.Unix(), tt.want)
+		}
+	}
+	for _, in := range []string{"", "yesterday", "2005-03-18", "1111111109.5"} {
+		if _, err := parseTime(in); err == nil {
+			t.Errorf("%q: expected an error", in)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"bksworm/totpcli/totpdb"
+)
+
+// completionFunc completes the arguments or the value of a flag of a command.
+type completionFunc func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective)
+
+var cmdCompletion = &cobra.Command{
+	Use:   "completion bash|zsh|fish|powershell",
+	Short: "Generate the shell completion script",
+	Long: `Generate the completion script for the shell, which also completes account names,
+issuers, IDs, tags and groups once "completion index on" is run. They are read from
+an index next to the database, so completion never asks for the password.
+
+To load completions in the current bash session:
+  source <(totp completion bash)
+To load them for every zsh session, add to ~/.zshrc:
+  source <(totp completion zsh)
+For fish:
+  totp completion fish > ~/.config/fish/completions/totp.fish
+For PowerShell, add to the profile:
+  totp completion powershell | Out-String | Invoke-Expression`,
+	ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+	Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root := cmd.Root()
+		switch args[0] {
+		case "bash":
+			return root.GenBashCompletionV2(os.Stdout, true)
+		case "zsh":
+			return root.GenZshCompletion(os.Stdout)
+		case "fish":
+			return root.GenFishCompletion(os.Stdout, true)
+		case "powershell":
+			return root.GenPowerShellCompletionWithDesc(os.Stdout)
+		}
+		return fmt.Errorf("unsupported shell %q", args[0])
+	},
+}
+
+// indexResult is the result of "completion index" in machine-readable formats.
+type indexResult struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+}
+
+var cmdCompletionIndex = &cobra.Command{
+	Use:       "index [on|off]",
+	Short:     "Show or set whether names are completed",
+	ValidArgs: []string{"on", "off"},
+	Long: `Show or set whether the index for completing account names, issuers, IDs, tags
+and groups is kept next to the database. The index holds no secrets, but it is not
+encrypted: anyone who can read it sees which accounts the database holds, without
+the password. It is off by default, and removed when turned off.`,
+	Args: cobra.MatchAll(cobra.MaximumNArgs(1), cobra.OnlyValidArgs),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openDB(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.close()
+
+		format := getOutput(cmd)
+		if len(args) == 1 {
+			db.data.CompletionIndex = args[0] == "on"
+			if err := db.save(); err != nil {
+				return err
+			}
+		}
+		if format != totpdb.FormatTable {
+			return totpdb.WriteValue(os.Stdout, format, indexResult{Enabled: db.data.CompletionIndex})
+		}
+		switch {
+		case len(args) == 0 && db.data.CompletionIndex:
+			fmt.Println("on")
+		case len(args) == 0:
+			fmt.Println("off")
+		case db.data.CompletionIndex:
+			conditionalPrintf(getQuiet(cmd), "Names are completed from the index %s\n", totpdb.IndexPath(db.path))
+		default:
+			conditionalPrintf(getQuiet(cmd), "Removed the index, names are no longer completed\n")
+		}
+		return nil
+	},
+}
+
+// completeFromIndex returns a completion function offering the values listed by
+// the index of the database that start with the text to complete. Values may carry
+// a description after a tab.
+func completeFromIndex(values func(cmd *cobra.Command, args []string, idx totpdb.Index) []string) completionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		path, err := resolveDBPath(cmd)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		idx, err := totpdb.ReadIndex(path)
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		var matches []string
+		for _, v := range values(cmd, args, idx) {
+			if strings.HasPrefix(v, toComplete) && !slices.Contains(matches, v) {
+				matches = append(matches, v)
+			}
+		}
+		return matches, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completeValues returns a completion function offering fixed values.
+func completeValues(values ...string) completionFunc {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return values, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// flagValue returns the value of a string flag of the command, empty if it has none.
+func flagValue(cmd *cobra.Command, name string) string {
+	if f := cmd.Flags().Lookup(name); f != nil {
+		return f.Value.String()
+	}
+	return ""
+}
+
+// completeAccounts offers the account names, of the issuer given by flag "issuer" if set.
+var completeAccounts = completeFromIndex(func(cmd *cobra.Command, args []string, idx totpdb.Index) []string {
+	issuer := flagValue(cmd, FLAG_ISSUER)
+	var accounts []string
+	for _, ent := range idx.Entries {
+		if issuer == "" || ent.Issuer == issuer {
+			accounts = append(accounts, ent.AccountName+"\t"+ent.Issuer)
+		}
+	}
+	return accounts
+})
+
+// completeIssuers offers the issuers, of the account given by flag "account" if set.
+var completeIssuers = completeFromIndex(func(cmd *cobra.Command, args []string, idx totpdb.Index) []string {
+	account := flagValue(cmd, FLAG_ACCOUNT)
+	var issuers []string
+	for _, ent := range idx.Entries {
+		if account == "" || ent.AccountName == account {
+			issuers = append(issuers, ent.Issuer)
+		}
+	}
+	return issuers
+})
+
+// indexIDs lists the short IDs of the entries with their issuer and account name as description.
+func indexIDs(entries []totpdb.IndexEntry) []string {
+	ids := make([]string, len(entries))
+	for i, ent := range entries {
+		ids[i] = totpdb.TOTPEntry{ID: ent.ID}.ShortID() + "\t" + ent.Issuer + " " + ent.AccountName
+	}
+	return ids
+}
+
+var completeIDs = completeFromIndex(func(cmd *cobra.Command, args []string, idx totpdb.Index) []string {
+	return indexIDs(idx.Entries)
+})
+
+// completeTags offers the tags of all entries, except those already given.
+var completeTags = completeFromIndex(func(cmd *cobra.Command, args []string, idx totpdb.Index) []string {
+	var tags []string
+	for _, ent := range idx.Entries {
+		for _, tag := range ent.Tags {
+			if !slices.Contains(args, tag) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	slices.Sort(tags)
+	return tags
+})
+
+var completeGroups = completeFromIndex(func(cmd *cobra.Command, args []string, idx totpdb.Index) []string {
+	var groups []string
+	for _, ent := range idx.Entries {
+		if ent.Group != "" {
+			groups = append(groups, ent.Group)
+		}
+	}
+	slices.Sort(groups)
+	return groups
+})
+
+// registerFlagCompletions adds the completion of the flags by name to the command and its subcommands.
+func registerFlagCompletions(cmd *cobra.Command, funcs map[string]completionFunc) {
+	for name, fn := range funcs {
+		if cmd.LocalNonPersistentFlags().Lookup(name) != nil {
+			cmd.RegisterFlagCompletionFunc(name, fn)
+		}
+	}
+	for _, sub := range cmd.Commands() {
+		registerFlagCompletions(sub, funcs)
+	}
+}
+
+func setCompletionCommands() {
+	cmdCompletion.AddCommand(cmdCompletionIndex)
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+	rootCmd.RegisterFlagCompletionFunc(FLAG_OUTPUT, completeValues(totpdb.Formats...))
+
+	registerFlagCompletions(rootCmd, map[string]completionFunc{
+		FLAG_ACCOUNT:         completeAccounts,
+		FLAG_ISSUER:          completeIssuers,
+		FLAG_ALL_FROM_ISSUER: completeIssuers,
+		FLAG_ID:              completeIDs,
+		FLAG_TAG:             completeTags,
+		FLAG_GROUP:           completeGroups,
+		FLAG_SORT:            completeValues(totpdb.SortKeys...),
+		FLAG_SELECTION:       completeValues(selectionClipboard, selectionPrimary),
+	})
+	cmdTagAdd.ValidArgsFunction = completeTags
+	cmdTagRemove.ValidArgsFunction = completeTags
+}
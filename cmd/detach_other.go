@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+import "os/exec"
+
+// detachProcess is a no-op, child processes already outlive this process.
+func detachProcess(cmd *exec.Cmd) {}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"bksworm/totpcli/totpdb"
+)
+
+const (
+	FLAG_NEW_ACCOUNT = "new-account"
+	FLAG_NEW_ISSUER  = "new-issuer"
+	FLAG_SECRET      = "secret"
+	FLAG_DIGITS      = "digits"
+	FLAG_PERIOD      = "period"
+	FLAG_ALGORITHM   = "algorithm"
+	SECRET_PROMT     = "Enter secret: "
+	// secretStdin is the value of the secret flag that reads the secret from standard input.
+	secretStdin = "-"
+)
+
+// getSecretFlag returns the secret given by flag, reading it with readSecret if
+// the value is "-". It reports false if the flag is not set.
+func getSecretFlag(cmd *cobra.Command) (string, bool, error) {
+	if !cmd.Flags().Changed(FLAG_SECRET) {
+		return "", false, nil
+	}
+	secret, _ := cmd.Flags().GetString(FLAG_SECRET)
+	if secret != secretStdin {
+		return secret, true, nil
+	}
+	secret, err := readSecret()
+	if err != nil {
+		return "", false, err
+	}
+	return secret, true, nil
+}
+
+// readSecret prompts for a secret on the terminal without echo or, if standard
+// input is not a terminal, reads it from the first line of standard input.
+func readSecret() (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", fmt.Errorf("error reading secret: %w", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	sec, err := ReadPassword(SECRET_PROMT)
+	if err != nil {
+		return "", fmt.Errorf("error reading secret: %w", err)
+	}
+	defer sec.Destroy()
+	return string(sec.Bytes()), nil
+}
+
+var cmdEdit = &cobra.Command{
+	Use:     "edit",
+	Aliases: []string{"e"},
+	Short:   "Edit a TOTP by id or account and issuer",
+	Long: `Edit the issuer, account name, secret, digits, period, algorithm, group,
+notes, favorite mark or icon of a TOTP. Only the fields given by flags are changed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, _ := cmd.Flags().GetString(FLAG_ID)
+		account, _ := cmd.Flags().GetString(FLAG_ACCOUNT)
+		issuer, _ := cmd.Flags().GetString(FLAG_ISSUER)
+
+		var upd totpdb.EntryUpdate
+		flags := cmd.Flags()
+		if flags.Changed(FLAG_NEW_ISSUER) {
+			val, _ := flags.GetString(FLAG_NEW_ISSUER)
+			upd.Issuer = &val
+		}
+		if flags.Changed(FLAG_NEW_ACCOUNT) {
+			val, _ := flags.GetString(FLAG_NEW_ACCOUNT)
+			upd.AccountName = &val
+		}
+		if flags.Changed(FLAG_DIGITS) {
+			val, _ := flags.GetInt(FLAG_DIGITS)
+			upd.Digits = &val
+		}
+		if flags.Changed(FLAG_PERIOD) {
+			val, _ := flags.GetUint64(FLAG_PERIOD)
+			upd.Period = &val
+		}
+		if flags.Changed(FLAG_ALGORITHM) {
+			val, _ := flags.GetString(FLAG_ALGORITHM)
+			upd.Algorithm = &val
+		}
+		if flags.Changed(FLAG_GROUP) {
+			val, _ := flags.GetString(FLAG_GROUP)
+			upd.Group = &val
+		}
+		if flags.Changed(FLAG_NOTES) {
+			val, _ := flags.GetString(FLAG_NOTES)
+			upd.Notes = &val
+		}
+		if flags.Changed(FLAG_FAVORITE) {
+			val, _ := flags.GetBool(FLAG_FAVORITE)
+			upd.Favorite = &val
+		}
+		if flags.Changed(FLAG_ICON) {
+			val, _ := flags.GetString(FLAG_ICON)
+			upd.Icon = &val
+		}
+		secret, ok, err := getSecretFlag(cmd)
+		if err != nil {
+			return err
+		}
+		if ok {
+			upd.Secret = &secret
+		}
+
+		db, err := openDB(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.close()
+
+		ind, err := getEntryIndex(cmd, db.data)
+		if err != nil {
+			return fmt.Errorf("error editing TOTP: %w", err)
+		}
+		issues, err := db.data.UpdateEntryAt(ind, upd)
+		if err != nil {
+			return fmt.Errorf("error editing TOTP: %w", err)
+		}
+		warnIssues(cmd, issues)
+		if err := db.save(); err != nil {
+			return err
+		}
+
+		if format := getOutput(cmd); format != totpdb.FormatTable {
+			return totpdb.WriteEntry(os.Stdout, format, db.data.Entries[ind].Info(), totpdb.ListOptions{})
+		}
+		quiet := getQuiet(cmd)
+		if id != "" {
+			conditionalPrintf(quiet, "Updated TOTP with id %s\n", id)
+		} else {
+			conditionalPrintf(quiet, "Updated TOTP for %s from %s\n", account, issuer)
+		}
+		return nil
+	},
+}
+
+func setEditCommands() {
+	setEntryFlags(cmdEdit, "edit")
+	cmdEdit.MarkFlagsOneRequired(FLAG_ID, FLAG_ACCOUNT)
+	cmdEdit.Flags().String(FLAG_NEW_ACCOUNT, "", "New account name")
+	cmdEdit.Flags().String(FLAG_NEW_ISSUER, "", "New issuer name")
+	cmdEdit.Flags().String(FLAG_SECRET, "", `New base32 secret, or "-" to be prompted for it or read it from standard input`)
+	// No defaults: parameters that are not given keep their current value
+	cmdEdit.Flags().Int(FLAG_DIGITS, 0, "New number of digits")
+	cmdEdit.Flags().Uint64(FLAG_PERIOD, 0, "New period in seconds")
+	cmdEdit.Flags().String(FLAG_ALGORITHM, "", "New algorithm: SHA1, SHA256 or SHA512")
+}
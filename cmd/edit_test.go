@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestSecretFlag(t *testing.T) {
+	// Standard input is not a terminal, so "-" reads its first line
+	in := filepath.Join(t.TempDir(), "stdin")
+	if err := os.WriteFile(in, []byte("JBSW Y3DP\nrest\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args []string
+		want string
+		ok   bool
+	}{
+		{nil, "", false},
+		{[]string{"--secret", "JBSWY3DP"}, "JBSWY3DP", true},
+		{[]string{"--secret=JBSWY3DP"}, "JBSWY3DP", true},
+		{[]string{"--secret", "-"}, "JBSW Y3DP", true},
+	}
+	for _, tt := range tests {
+		f, err := os.Open(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stdin := os.Stdin
+		os.Stdin = f
+
+		cmd := &cobra.Command{Args: cobra.NoArgs}
+		cmd.Flags().String(FLAG_SECRET, "", "")
+		if err := cmd.ParseFlags(tt.args); err != nil {
+			t.Fatalf("%q: %v", tt.args, err)
+		}
+		if rest := cmd.Flags().Args(); len(rest) > 0 {
+			t.Errorf("%q: left arguments %q", tt.args, rest)
+		}
+		got, ok, err := getSecretFlag(cmd)
+		os.Stdin = stdin
+		f.Close()
+		if err != nil || got != tt.want || ok != tt.ok {
+			t.Errorf("%q: got %q, %v, %v, want %q, %v", tt.args, got, ok, err, tt.want, tt.ok)
+		}
+	}
+}
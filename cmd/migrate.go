@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"bksworm/totpcli/totpdb"
+)
+
+var cmdMigrate = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the database to the current layout",
+	Long: `Upgrade the database to the current layout.
+Entries of older databases store the otpauth URL next to its parameters, which
+keeps a second copy of the secret. The URLs are checked against the parameters,
+any inconsistency is reported, and then the URLs are dropped. The parameters
+are kept, as they are the ones used to generate codes.
+Entries without an ID get one. In the machine-readable output formats the
+inconsistencies are written as a list of records.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openDB(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.close()
+
+		quiet := getQuiet(cmd)
+		format := getOutput(cmd)
+		if !db.data.NeedsMigration() {
+			conditionalPrintf(quiet, "Database is up to date\n")
+			if format != totpdb.FormatTable {
+				return totpdb.WriteValues(os.Stdout, format, []totpdb.URLIssue{})
+			}
+			return nil
+		}
+
+		issues, err := db.data.Migrate()
+		if err != nil {
+			return fmt.Errorf("error migrating TOTP data: %w", err)
+		}
+		if err := db.save(); err != nil {
+			return err
+		}
+		if format != totpdb.FormatTable {
+			if issues == nil {
+				issues = []totpdb.URLIssue{}
+			}
+			return totpdb.WriteValues(os.Stdout, format, issues)
+		}
+		for _, iss := range issues {
+			fmt.Println(iss)
+		}
+
+		conditionalPrintf(quiet, "Migrated %d entries, found %d inconsistencies\n", len(db.data.Entries), len(issues))
+		return nil
+	},
+}
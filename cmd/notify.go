@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const FLAG_NOTIFY = "notify"
+
+const (
+	notificationsName = "org.freedesktop.Notifications"
+	notificationsPath = "/org/freedesktop/Notifications"
+)
+
+// notifyTimeout is how long codes that do not expire, those of HOTP entries, are shown.
+const notifyTimeout = 30 * time.Second
+
+// notifier shows desktop notifications.
+type notifier interface {
+	// Notify shows a notification that expires after timeout,
+	// or after the default of the server if timeout is not positive.
+	Notify(summary, body string, timeout time.Duration) error
+}
+
+// dbusNotifier sends notifications to the notification server of the
+// D-Bus session bus, see the freedesktop Desktop Notifications Specification.
+type dbusNotifier struct{}
+
+func (dbusNotifier) Notify(summary, body string, timeout time.Duration) error {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// Transient notifications are not kept in the history of the server
+	hints := map[string]dbus.Variant{"transient": dbus.MakeVariant(true)}
+	// An expiration of 0 keeps the notification until it is closed, -1 leaves it to the server
+	expire := int32(-1)
+	if timeout > 0 {
+		expire = int32(timeout.Milliseconds())
+	}
+	return conn.Object(notificationsName, notificationsPath).Call(notificationsName+".Notify", 0,
+		"totp", uint32(0), "dialog-password", summary, body, []string{}, hints, expire,
+	).Err
+}
+
+// notifyCode shows the code, or that it was copied, until it expires, or for
+// notifyTimeout if remaining is zero as the code does not expire.
+// The code has been printed, copied or typed already, so a failure is only
+// reported as a warning to warn.
+func notifyCode(n notifier, warn io.Writer, account, issuer, code string, copied bool, remaining time.Duration) {
+	if remaining <= 0 {
+		remaining = notifyTimeout
+	}
+	summary := fmt.Sprintf("TOTP for %s from %s", account, issuer)
+	body := code
+	if copied {
+		body = "Code copied to clipboard"
+	}
+	if err := n.Notify(summary, body, remaining); err != nil {
+		fmt.Fprintf(warn, "Warning: error sending notification: %s\n", err)
+	}
+}
+
+func setNotifyCommands() {
+	cmdGenerate.Flags().Bool(FLAG_NOTIFY, false, "Show the code, or that it was copied with flag \"clipboard\", in a desktop notification")
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// fakeNotifier records the notifications and fails with err if set.
+type fakeNotifier struct {
+	summary, body string
+	timeout       time.Duration
+	err           error
+}
+
+func (n *fakeNotifier) Notify(summary, body string, timeout time.Duration) error {
+	n.summary, n.body, n.timeout = summary, body, timeout
+	return n.err
+}
+
+func TestNotifyCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		copied bool
+		body   string
+	}{
+		{"code", false, "123456"},
+		{"copied", true, "Code copied to clipboard"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var n fakeNotifier
+			var warn bytes.Buffer
+			notifyCode(&n, &warn, "alice", "ACME", "123456", tt.copied, 17*time.Second)
+			if want := "TOTP for alice from ACME"; n.summary != want {
+				t.Errorf("got summary %q, want %q", n.summary, want)
+			}
+			if n.body != tt.body {
+				t.Errorf("got body %q, want %q", n.body, tt.body)
+			}
+			if n.timeout != 17*time.Second {
+				t.Errorf("got timeout %s, want the remaining validity", n.timeout)
+			}
+			if warn.Len() != 0 {
+				t.Errorf("unexpected warning %q", warn.String())
+			}
+		})
+	}
+}
+
+func TestNotifyCodeHOTP(t *testing.T) {
+	// HOTP codes do not expire, yet the notification must
+	var n fakeNotifier
+	notifyCode(&n, &bytes.Buffer{}, "alice", "ACME", "123456", false, 0)
+	if n.timeout != notifyTimeout {
+		t.Errorf("got timeout %s, want %s", n.timeout, notifyTimeout)
+	}
+}
+
+func TestNotifyCodeFailureWarns(t *testing.T) {
+	n := fakeNotifier{err: errors.New("no notification server")}
+	var warn bytes.Buffer
+	notifyCode(&n, &warn, "alice", "ACME", "123456", false, time.Second)
+	if got := warn.String(); !strings.HasPrefix(got, "Warning:") || !strings.Contains(got, "no notification server") {
+		t.Errorf("got warning %q", got)
+	}
+}
+
+// notificationServer implements the Notify method of org.freedesktop.Notifications.
+type notificationServer struct {
+	calls chan []any
+}
+
+func (s notificationServer) Notify(app string, replaces uint32, icon, summary, body string,
+	actions []string, hints map[string]dbus.Variant, timeout int32) (uint32, *dbus.Error) {
+	s.calls <- []any{app, summary, body, hints["transient"].Value(), timeout}
+	return 1, nil
+}
+
+// startSessionBus starts a private D-Bus session bus for the test and points
+// DBUS_SESSION_BUS_ADDRESS at it.
+func startSessionBus(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon not installed")
+	}
+	daemon := exec.Command("dbus-daemon", "--session", "--nofork", "--print-address=1")
+	out, err := daemon.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := daemon.Start(); err != nil {
+		t.Skipf("starting dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		daemon.Process.Kill()
+		daemon.Wait()
+	})
+	addr, err := bufio.NewReader(out).ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading the address of dbus-daemon: %v", err)
+	}
+	addr = strings.TrimSpace(addr)
+	t.Setenv("DBUS_SESSION_BUS_ADDRESS", addr)
+	return addr
+}
+
+func TestDBusNotifier(t *testing.T) {
+	addr := startSessionBus(t)
+	conn, err := dbus.Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	srv := notificationServer{calls: make(chan []any, 1)}
+	if err := conn.Export(srv, notificationsPath, notificationsName); err != nil {
+		t.Fatal(err)
+	}
+	if reply, err := conn.RequestName(notificationsName, dbus.NameFlagDoNotQueue); err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("requesting the name %s: %v", notificationsName, err)
+	}
+
+	tests := []struct {
+		timeout time.Duration
+		expire  int32
+	}{
+		{17 * time.Second, 17000},
+		// Never 0, which keeps the notification on screen for ever
+		{0, -1},
+	}
+	for _, tt := range tests {
+		if err := (dbusNotifier{}).Notify("TOTP for alice from ACME", "123456", tt.timeout); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case got := <-srv.calls:
+			want := []any{"totp", "TOTP for alice from ACME", "123456", true, tt.expire}
+			for i := range want {
+				if got[i] != want[i] {
+					t.Errorf("got notification %v, want %v", got, want)
+					break
+				}
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("notification not received")
+		}
+	}
+}
+
+func TestDBusNotifierWithoutServer(t *testing.T) {
+	startSessionBus(t)
+	if err := (dbusNotifier{}).Notify("summary", "body", time.Second); err == nil {
+		t.Error("expected an error without a notification server")
+	}
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+
+	"bksworm/totpcli/totpdb"
+)
+
+var errPickCanceled = errors.New("selection canceled")
+
+// pickerRows is the number of matches the picker shows at once.
+const pickerRows = 10
+
+// Keys the picker reacts to, as read from a terminal in raw mode.
+const (
+	keyCtrlC     = 3
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyBackspace = 8
+	keyEnter     = 13
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// picker is an interactive fuzzy finder over the entries of a database.
+type picker struct {
+	data     *totpdb.TOTPData
+	out      io.Writer
+	query    string
+	matches  []totpdb.Match
+	selected int
+	pending  []byte // start of a character split between reads
+}
+
+// pickEntry lets the user choose an entry in the terminal, filtering the
+// entries by fuzzy search as they type. Only metadata is shown.
+// It returns the index of the chosen entry.
+func pickEntry(data *totpdb.TOTPData) (int, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return -1, fmt.Errorf("no TOTP selected and standard input is not a terminal")
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return -1, err
+	}
+	defer term.Restore(fd, state)
+
+	p := &picker{data: data, out: os.Stderr}
+	p.filter()
+	defer p.clear()
+
+	buf := make([]byte, 16)
+	for {
+		p.render()
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return -1, err
+		}
+		done, err := p.handle(buf[:n])
+		if err != nil {
+			return -1, err
+		}
+		if done {
+			return p.matches[p.selected].Index, nil
+		}
+	}
+}
+
+// filter updates the matches after the query changed.
+func (p *picker) filter() {
+	p.matches = p.data.Search(p.query)
+	p.selected = 0
+}
+
+// key is a key press read from the terminal: a character, control characters
+// included, or an escape sequence such as "\x1b[A" for Up.
+type key struct {
+	r   rune
+	seq string
+}
+
+// decodeKeys splits the input read from the terminal into key presses. Characters
+// are decoded from UTF-8; an incomplete character at the end of the input is returned
+// as rest, to be completed by the next read, and invalid bytes are dropped.
+// An Escape followed by more input starts an escape sequence: CSI sequences like
+// "\x1b[A" and "\x1b[3~", SS3 sequences like "\x1bOA" and Alt with a key. Only an
+// Escape at the end of the input is the Escape key itself.
+func decodeKeys(in []byte) (keys []key, rest []byte) {
+	for i := 0; i < len(in); {
+		if in[i] != keyEscape || i+1 == len(in) {
+			if !utf8.FullRune(in[i:]) {
+				return keys, in[i:]
+			}
+			r, size := utf8.DecodeRune(in[i:])
+			if r != utf8.RuneError || size > 1 {
+				keys = append(keys, key{r: r})
+			}
+			i += size
+			continue
+		}
+		end := i + 2
+		switch in[i+1] {
+		case '[':
+			// Parameters up to the final byte
+			for end < len(in) && (in[end] < 0x40 || in[end] > 0x7e) {
+				end++
+			}
+			end = min(end+1, len(in))
+		case 'O':
+			end = min(end+1, len(in))
+		}
+		keys = append(keys, key{seq: string(in[i:end])})
+		i = end
+	}
+	return keys, nil
+}
+
+// keys decodes the input read from the terminal, continuing a character split
+// between the previous read and this one.
+func (p *picker) keys(in []byte) []key {
+	keys, rest := decodeKeys(append(p.pending, in...))
+	p.pending = rest
+	return keys
+}
+
+// handle processes the input read from the terminal.
+// It reports true once an entry is chosen.
+func (p *picker) handle(in []byte) (bool, error) {
+	for _, k := range p.keys(in) {
+		if k.seq != "" {
+			// Other escape sequences are ignored
+			switch k.seq {
+			case "\x1b[A", "\x1bOA":
+				p.move(-1)
+			case "\x1b[B", "\x1bOB":
+				p.move(1)
+			}
+			continue
+		}
+
+		switch k.r {
+		case keyCtrlC, keyEscape:
+			return false, errPickCanceled
+		case keyEnter:
+			if len(p.matches) > 0 {
+				return true, nil
+			}
+		case keyCtrlP:
+			p.move(-1)
+		case keyCtrlN:
+			p.move(1)
+		case keyCtrlU:
+			p.query = ""
+			p.filter()
+		case keyBackspace, keyDelete:
+			if p.query != "" {
+				_, size := utf8.DecodeLastRuneInString(p.query)
+				p.query = p.query[:len(p.query)-size]
+				p.filter()
+			}
+		default:
+			if k.r >= ' ' {
+				p.query += string(k.r)
+				p.filter()
+			}
+		}
+	}
+	return false, nil
+}
+
+// move moves the selection by delta, staying within the matches.
+func (p *picker) move(delta int) {
+	p.selected += delta
+	if p.selected >= len(p.matches) {
+		p.selected = len(p.matches) - 1
+	}
+	if p.selected < 0 {
+		p.selected = 0
+	}
+}
+
+// render draws the query line and the visible matches below it,
+// and leaves the cursor at the end of the query.
+func (p *picker) render() {
+	fmt.Fprint(p.out, "\r\x1b[J")
+
+	// Scroll so that the selection is visible
+	first := 0
+	if p.selected >= pickerRows {
+		first = p.selected - pickerRows + 1
+	}
+	last := min(first+pickerRows, len(p.matches))
+
+	for i := first; i < last; i++ {
+		ent := p.data.Entries[p.matches[i].Index]
+		marker := "  "
+		if i == p.selected {
+			marker = "\x1b[7m>"
+		}
+		fmt.Fprintf(p.out, "\r\n%s %-8s  %s  %s\x1b[0m", marker, ent.ShortID(),
+			totpdb.FitCell(ent.Issuer, 20), totpdb.CleanCell(ent.AccountName))
+	}
+	fmt.Fprintf(p.out, "\r\n  %d/%d", len(p.matches), len(p.data.Entries))
+
+	// Back to the query line
+	fmt.Fprintf(p.out, "\x1b[%dA\r> %s", last-first+1, p.query)
+}
+
+// clear removes the picker from the screen.
+func (p *picker) clear() {
+	fmt.Fprint(p.out, "\r\x1b[J")
+}
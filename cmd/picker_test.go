@@ -0,0 +1,116 @@
+package main
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"bksworm/totpcli/totpdb"
+)
+
+func TestDecodeKeys(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []key
+		rest string
+	}{
+		{"ab", []key{{r: 'a'}, {r: 'b'}}, ""},
+		{"\x1b", []key{{r: keyEscape}}, ""},
+		{"\x1b[A", []key{{seq: "\x1b[A"}}, ""},
+		{"\x1bOB", []key{{seq: "\x1bOB"}}, ""},
+		{"\x1b[3~x", []key{{seq: "\x1b[3~"}, {r: 'x'}}, ""},
+		{"\x1b[1;5Cy\x1b[B", []key{{seq: "\x1b[1;5C"}, {r: 'y'}, {seq: "\x1b[B"}}, ""},
+		{"\x1bx", []key{{seq: "\x1bx"}}, ""},
+		{"a\x1b", []key{{r: 'a'}, {r: keyEscape}}, ""},
+		{"\x1b[", []key{{seq: "\x1b["}}, ""},
+		{"ü東", []key{{r: 'ü'}, {r: '東'}}, ""},
+		{"a\xe6\x9d", []key{{r: 'a'}}, "\xe6\x9d"},
+		{"\xffb", []key{{r: 'b'}}, ""},
+	}
+	for _, tt := range tests {
+		got, rest := decodeKeys([]byte(tt.in))
+		if !reflect.DeepEqual(got, tt.want) || string(rest) != tt.rest {
+			t.Errorf("decodeKeys(%q) = %q, %q, want %q, %q", tt.in, got, rest, tt.want, tt.rest)
+		}
+	}
+}
+
+func testPicker() *picker {
+	data := &totpdb.TOTPData{Entries: []totpdb.TOTPEntry{
+		{Issuer: "ACME", AccountName: "alice"},
+		{Issuer: "Bank", AccountName: "bob"},
+	}}
+	p := &picker{data: data, out: io.Discard}
+	p.filter()
+	return p
+}
+
+func TestPickerEscapeSequences(t *testing.T) {
+	p := testPicker()
+	// Down and Delete arrive together with typed keys and are no Escape
+	if _, err := p.handle([]byte("\x1b[B\x1b[3~b")); err != nil {
+		t.Fatalf("escape sequences canceled the picker: %v", err)
+	}
+	if p.query != "b" {
+		t.Errorf("got query %q, want %q", p.query, "b")
+	}
+	if _, err := p.handle([]byte("\x1b")); err != errPickCanceled {
+		t.Errorf("got error %v for Escape, want %v", err, errPickCanceled)
+	}
+}
+
+func TestPickerUTF8(t *testing.T) {
+	p := testPicker()
+	// "ü" and "東" are split between reads
+	for _, in := range []string{"j\xc3", "\xbc\xe6", "\x9d\xb1"} {
+		if _, err := p.handle([]byte(in)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p.query != "jü東" {
+		t.Errorf("got query %q, want %q", p.query, "jü東")
+	}
+	p.handle([]byte{keyDelete})
+	if p.query != "jü" {
+		t.Errorf("got query %q after backspace, want %q", p.query, "jü")
+	}
+}
+
+func TestWatcherLockedEscapeSequences(t *testing.T) {
+	p := testPicker()
+	w := &watcher{picker: *p, db: &dbSession{data: p.data}}
+	w.lock()
+	quit, err := w.handleLocked([]byte("pw\x1b[A\x1b[D\x1bOB"))
+	if err != nil || quit {
+		t.Fatalf("escape sequences quit the locked dashboard: %v", err)
+	}
+	if got := string(w.password.Bytes()[:w.typed]); got != "pw" {
+		t.Errorf("got password %q, want %q", got, "pw")
+	}
+	w.handleLocked([]byte("ß€"))
+	w.handleLocked([]byte{keyBackspace})
+	if got := string(w.password.Bytes()[:w.typed]); got != "pwß" {
+		t.Errorf("got password %q after backspace, want %q", got, "pwß")
+	}
+	if quit, _ := w.handleLocked([]byte("\x1b")); !quit {
+		t.Error("Escape did not quit the locked dashboard")
+	}
+}
+
+func TestPickerRenderCleansNames(t *testing.T) {
+	var out strings.Builder
+	p := &picker{data: &totpdb.TOTPData{Entries: []totpdb.TOTPEntry{
+		{Issuer: "Evil\x1b]0;pwned\x07 Corporation International", AccountName: "mallory\r\n\x1b[2J"},
+	}}, out: &out}
+	p.filter()
+	p.render()
+	for _, seq := range []string{"\x1b]", "\x07", "\x1b[2J"} {
+		if strings.Contains(out.String(), seq) {
+			t.Errorf("rendered %q from a name: %q", seq, out.String())
+		}
+	}
+	if !strings.Contains(out.String(), "Evil ]0;pwned  Corp…") {
+		t.Errorf("issuer not cut to its column: %q", out.String())
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"bksworm/totpcli/totpdb"
+)
+
+var cmdRecipients = &cobra.Command{
+	Use:     "recipients",
+	Aliases: []string{"rcp"},
+	Short:   "Manage age recipients of the database",
+	Long: `Manage the age X25519 recipients the database key is wrapped to.
+A recipient can unlock the database with its identity file (see age-keygen)
+passed by flag "identity" or environment variable "TOTP_IDENTITY".`,
+}
+
+var cmdRecipientsList = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"l"},
+	Short:   "List age recipients",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openDB(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.close()
+		return totpdb.WriteList(os.Stdout, getOutput(cmd), "recipient", db.data.Recipients())
+	},
+}
+
+var cmdRecipientsAdd = &cobra.Command{
+	Use:   "add RECIPIENT...",
+	Short: "Wrap the database key to age recipients",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openDB(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.close()
+		for _, r := range args {
+			if err := db.data.AddRecipient(r); err != nil {
+				return fmt.Errorf("error adding recipient %s: %w", r, err)
+			}
+		}
+		if err := db.save(); err != nil {
+			return err
+		}
+
+		quiet := getQuiet(cmd)
+		conditionalPrintf(quiet, "Added %d recipient(s)\n", len(args))
+		return nil
+	},
+}
+
+var cmdRecipientsRemove = &cobra.Command{
+	Use:     "remove RECIPIENT...",
+	Aliases: []string{"rm"},
+	Short:   "Remove age recipients from the database",
+	Long: `Remove age recipients from the database and revoke them: the database key is
+replaced and wrapped again for the password, the recovery key and the remaining
+recipients, so that a removed recipient can not read later versions of the database.
+When the database is opened with an identity file, the password is asked for as well.`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openDB(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.close()
+		if db.pwd == nil && db.data.HasPassword() {
+			// Opened with an identity, the password slot can only be wrapped again with the password
+			if db.pwd, db.salt, err = getPwdSalt(cmd); err != nil {
+				return err
+			}
+		}
+		if err := db.data.RemoveRecipients(args, db.pwd.Bytes(), db.salt); err != nil {
+			return fmt.Errorf("error removing recipients: %w", err)
+		}
+		if err := db.save(); err != nil {
+			return err
+		}
+
+		quiet := getQuiet(cmd)
+		conditionalPrintf(quiet, "Removed %d recipient(s) and replaced the database key\n", len(args))
+		return nil
+	},
+}
+
+func setRecipientsCommands() {
+	cmdRecipients.AddCommand(cmdRecipientsList, cmdRecipientsAdd, cmdRecipientsRemove)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+	"github.com/spf13/cobra"
+
+	"bksworm/totpcli/totpdb"
+)
+
+const (
+	FLAG_QR            = "qr"
+	RECOVERY_KEY_PROMT = "Enter recovery key: "
+)
+
+// recoveryResult is the result of "recovery generate" in machine-readable formats.
+type recoveryResult struct {
+	RecoveryKey string `json:"recovery_key" yaml:"recovery_key"`
+	Replaced    bool   `json:"replaced" yaml:"replaced"`
+}
+
+var cmdRecovery = &cobra.Command{
+	Use:   "recovery",
+	Short: "Manage the recovery key of the database",
+	Long: `Manage the recovery key of the database.
+The recovery key opens the database when the password is forgotten.`,
+}
+
+var cmdRecoveryGenerate = &cobra.Command{
+	Use:     "generate",
+	Aliases: []string{"gen", "g"},
+	Short:   "Generate a new recovery key",
+	Long: `Generate a new recovery key, a phrase of 15 words, replacing the previous one.
+Print it or write it down and keep it in a safe place, it is shown only once.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		showQR, _ := cmd.Flags().GetBool(FLAG_QR)
+		format := getOutput(cmd)
+		if showQR && format != totpdb.FormatTable {
+			return fmt.Errorf("flag --%s needs the table output format", FLAG_QR)
+		}
+
+		db, err := openDB(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.close()
+		replaced := db.data.HasRecoveryKey()
+
+		code, err := totpdb.GenerateRecoveryKey()
+		if err != nil {
+			return fmt.Errorf("error generating recovery key: %w", err)
+		}
+		if err := db.data.SetRecoveryKey([]byte(code)); err != nil {
+			return fmt.Errorf("error setting recovery key: %w", err)
+		}
+		if err := db.save(); err != nil {
+			return err
+		}
+
+		if format != totpdb.FormatTable {
+			return totpdb.WriteValue(os.Stdout, format, recoveryResult{RecoveryKey: code, Replaced: replaced})
+		}
+		quiet := getQuiet(cmd)
+		if replaced {
+			conditionalPrintf(quiet, "The previous recovery key no longer works\n")
+		}
+		conditionalPrintf(quiet, "Recovery key: ")
+		fmt.Println(code)
+		if showQR {
+			qr, err := renderQR(code)
+			if err != nil {
+				return fmt.Errorf("error encoding QR code: %w", err)
+			}
+			fmt.Print(qr)
+		}
+		return nil
+	},
+}
+
+var cmdRecoveryUnlock = &cobra.Command{
+	Use:   "unlock",
+	Short: "Open the database with the recovery key and set a new password",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dbPath := getDBFilePath(cmd)
+
+		code, err := ReadPassword(RECOVERY_KEY_PROMT)
+		if err != nil {
+			return fmt.Errorf("error reading recovery key: %w", err)
+		}
+		data, err := totpdb.ReadCBORSecRecovery(dbPath, code.Bytes())
+		code.Destroy()
+		if err != nil {
+			return fmt.Errorf("error reading TOTP data: %w", err)
+		}
+
+		pwd, err := ReadNewPassword()
+		if err != nil {
+			data.Close()
+			return fmt.Errorf(PWD_ERROR_WRAP, err)
+		}
+		db := &dbSession{path: dbPath, pwd: pwd, salt: GetSalt(cmd), data: data}
+		defer db.close()
+		if err := db.save(); err != nil {
+			return err
+		}
+
+		quiet := getQuiet(cmd)
+		conditionalPrintf(quiet, "Password changed, the recovery key still works\n")
+		return nil
+	},
+}
+
+// renderQR renders the text as a QR code drawn with block characters.
+func renderQR(text string) (string, error) {
+	matrix, err := qrcode.NewQRCodeWriter().Encode(text, gozxing.BarcodeFormat_QR_CODE, 0, 0, nil)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for y := 0; y < matrix.GetHeight(); y++ {
+		for x := 0; x < matrix.GetWidth(); x++ {
+			if matrix.Get(x, y) {
+				sb.WriteString("  ")
+			} else {
+				sb.WriteString("██")
+			}
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String(), nil
+}
+
+func setRecoveryCommands() {
+	cmdRecovery.AddCommand(cmdRecoveryGenerate, cmdRecoveryUnlock)
+
+	cmdRecoveryGenerate.Flags().Bool(FLAG_QR, false, "Also print the recovery key as a QR code")
+}
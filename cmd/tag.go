@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"bksworm/totpcli/totpdb"
+)
+
+const (
+	FLAG_TAG      = "tag"
+	FLAG_GROUP    = "group"
+	FLAG_NOTES    = "notes"
+	FLAG_FAVORITE = "favorite"
+	FLAG_ICON     = "icon"
+)
+
+var cmdTag = &cobra.Command{
+	Use:   "tag",
+	Short: "Manage the tags of TOTPs",
+	Long: `Add tags to TOTPs, remove them or list the tags in use.
+Tags are case insensitive words without spaces or commas. They are matched by
+the fuzzy search and select TOTPs with "list --tag".`,
+}
+
+var cmdTagAdd = &cobra.Command{
+	Use:   "add TAG...",
+	Short: "Add tags to a TOTP by id or account and issuer",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return changeTags(cmd, func(data *totpdb.TOTPData, ind int) error {
+			return data.TagEntry(ind, args...)
+		})
+	},
+}
+
+var cmdTagRemove = &cobra.Command{
+	Use:     "remove TAG...",
+	Aliases: []string{"rm"},
+	Short:   "Remove tags from a TOTP by id or account and issuer",
+	Args:    cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return changeTags(cmd, func(data *totpdb.TOTPData, ind int) error {
+			data.UntagEntry(ind, args...)
+			return nil
+		})
+	},
+}
+
+var cmdTagList = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"l"},
+	Short:   "List the tags in use and how many TOTPs have each",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openDB(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.close()
+
+		counts := db.data.Tags()
+		tags := make([]string, 0, len(counts))
+		for t := range counts {
+			tags = append(tags, t)
+		}
+		sort.Strings(tags)
+
+		format := getOutput(cmd)
+		if format != totpdb.FormatTable {
+			return totpdb.WriteList(os.Stdout, format, FLAG_TAG, tags)
+		}
+		for _, t := range tags {
+			fmt.Printf("%s (%d)\n", t, counts[t])
+		}
+		return nil
+	},
+}
+
+// changeTags applies change to the entry selected by the entry flags and saves the database.
+func changeTags(cmd *cobra.Command, change func(data *totpdb.TOTPData, ind int) error) error {
+	db, err := openDB(cmd)
+	if err != nil {
+		return err
+	}
+	defer db.close()
+
+	ind, err := getEntryIndex(cmd, db.data)
+	if err != nil {
+		return fmt.Errorf("error selecting TOTP: %w", err)
+	}
+	if err := change(db.data, ind); err != nil {
+		return fmt.Errorf("error changing tags: %w", err)
+	}
+	if err := db.save(); err != nil {
+		return err
+	}
+
+	ent := db.data.Entries[ind]
+	if format := getOutput(cmd); format != totpdb.FormatTable {
+		return totpdb.WriteEntry(os.Stdout, format, ent.Info(), totpdb.ListOptions{})
+	}
+	conditionalPrintf(getQuiet(cmd), "Tags of %s from %s: %v\n", ent.AccountName, ent.Issuer, ent.Tags)
+	return nil
+}
+
+func setTagCommands() {
+	cmdTag.AddCommand(cmdTagAdd, cmdTagRemove, cmdTagList)
+	setEntryFlags(cmdTagAdd, "tag")
+	setEntryFlags(cmdTagRemove, "untag")
+
+	cmdEdit.Flags().String(FLAG_GROUP, "", "New group, subgroups are separated by slashes, empty to ungroup")
+	cmdEdit.Flags().String(FLAG_NOTES, "", "New notes")
+	cmdEdit.Flags().Bool(FLAG_FAVORITE, false, "Mark as favorite, --favorite=false to unmark")
+	cmdEdit.Flags().String(FLAG_ICON, "", "New icon name or path")
+}
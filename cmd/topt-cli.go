@@ -1,12 +1,14 @@
 package main
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"image"
 	_ "image/jpeg"
 	_ "image/png"
 	"os"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
@@ -16,7 +18,6 @@ import (
 	"github.com/makiuchi-d/gozxing"
 	"github.com/makiuchi-d/gozxing/qrcode"
 	"github.com/pquerna/otp"
-	"github.com/pquerna/otp/totp"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
@@ -24,17 +25,28 @@ import (
 )
 
 const (
-	FLAG_SALT      = "salt"
-	FLAG_ACCOUNT   = "account"
-	FLAG_ISSUER    = "issuer"
-	FLAG_URL       = "url"
-	FLAG_IMAGE     = "image"
-	FLAG_QRC       = "qrc"
-	FLAG_DB        = "db"
-	FLAG_CLIP      = "clipboard"
-	FLAG_QUIET     = "quiet"
-	PWD_PROMT      = "Enter password: "
-	PWD_ERROR_WRAP = "error reading password: %w"
+	FLAG_SALT        = "salt"
+	FLAG_ACCOUNT     = "account"
+	FLAG_ISSUER      = "issuer"
+	FLAG_ID          = "id"
+	FLAG_CODES       = "codes"
+	FLAG_NEXT        = "next"
+	FLAG_URL         = "url"
+	FLAG_IMAGE       = "image"
+	FLAG_QRC         = "qrc"
+	FLAG_DB          = "db"
+	FLAG_CLIP        = "clipboard"
+	FLAG_QUIET       = "quiet"
+	FLAG_IDENTITY    = "identity"
+	FLAG_OUTPUT      = "output"
+	FLAG_SORT        = "sort"
+	FLAG_FILTER      = "filter"
+	FLAG_COLUMNS     = "columns"
+	FLAG_LIMIT       = "limit"
+	PWD_PROMT        = "Enter password: "
+	PWD_NEW_PROMT    = "Enter new password: "
+	PWD_REPEAT_PROMT = "Repeat new password: "
+	PWD_ERROR_WRAP   = "error reading password: %w"
 )
 
 // githash is the Git commit hash of the current build.
@@ -42,14 +54,35 @@ const (
 var githash = "NONE"
 
 // ReadPassword reads a password from the terminal without echoing it.
-func ReadPassword(prompt string) (string, error) {
-	fmt.Print(prompt)
+// The caller must Destroy the returned secret.
+func ReadPassword(prompt string) (*totpdb.Secret, error) {
+	// The prompt goes to stderr to keep stdout clean for machine-readable output
+	fmt.Fprint(os.Stderr, prompt)
 	bytePassword, err := term.ReadPassword(int(syscall.Stdin))
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	fmt.Fprintln(os.Stderr) // Print a newline after the password input
+	return totpdb.NewSecretFrom(bytePassword), nil
+}
+
+// ReadNewPassword reads a new password twice and checks that both inputs match.
+func ReadNewPassword() (*totpdb.Secret, error) {
+	pwd, err := ReadPassword(PWD_NEW_PROMT)
+	if err != nil {
+		return nil, err
+	}
+	again, err := ReadPassword(PWD_REPEAT_PROMT)
+	if err != nil {
+		pwd.Destroy()
+		return nil, err
 	}
-	fmt.Println() // Print a newline after the password input
-	return string(bytePassword), nil
+	defer again.Destroy()
+	if subtle.ConstantTimeCompare(pwd.Bytes(), again.Bytes()) != 1 {
+		pwd.Destroy()
+		return nil, fmt.Errorf("passwords do not match")
+	}
+	return pwd, nil
 }
 
 // conditionalPrintf prints a formatted string if the quiet flag is false.
@@ -73,25 +106,231 @@ func GetSalt(cmd *cobra.Command) []byte {
 }
 
 // getPwdSalt reads the password from the terminal and retrieves the salt value.
-// It returns the password string, the salt as a byte slice, and any error that occurred.
-func getPwdSalt(cmd *cobra.Command) (string, []byte, error) {
+// It returns the password secret, the salt as a byte slice, and any error that occurred.
+func getPwdSalt(cmd *cobra.Command) (*totpdb.Secret, []byte, error) {
 	pwd, err := ReadPassword(PWD_PROMT)
 	if err != nil {
-		return "", nil, fmt.Errorf(PWD_ERROR_WRAP, err)
+		return nil, nil, fmt.Errorf(PWD_ERROR_WRAP, err)
 	}
 	return pwd, GetSalt(cmd), nil
 }
 
+// getIdentityPath returns the age identity file used to unlock the database
+// from the command-line flag or environment variable, or "" if none is set.
+func getIdentityPath(cmd *cobra.Command) (string, error) {
+	path, _ := cmd.Flags().GetString(FLAG_IDENTITY)
+	if path == "" {
+		path = viper.GetString(FLAG_IDENTITY)
+	}
+	if path == "" {
+		return "", nil
+	}
+	return expandHome(path)
+}
+
+// dbSession holds an opened database and what is needed to write it back.
+type dbSession struct {
+	path string
+	pwd  *totpdb.Secret
+	salt []byte
+	data *totpdb.TOTPData
+}
+
+// openDB reads the database, unlocking it with the identity file if one is
+// configured and with the password otherwise.
+func openDB(cmd *cobra.Command) (*dbSession, error) {
+	s := &dbSession{path: getDBFilePath(cmd)}
+
+	identity, err := getIdentityPath(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if identity != "" {
+		ids, err := totpdb.LoadIdentities(identity)
+		if err != nil {
+			return nil, fmt.Errorf("error reading identity file: %w", err)
+		}
+		s.data, err = totpdb.ReadCBORSecIdentity(s.path, ids)
+		if err != nil {
+			return nil, fmt.Errorf("error reading TOTP data: %w", err)
+		}
+		s.checkVersion(cmd)
+		s.checkIndex()
+		s.applyUsage()
+		return s, nil
+	}
+
+	// Get the password and salt
+	s.pwd, s.salt, err = getPwdSalt(cmd)
+	if err != nil {
+		return nil, err
+	}
+	s.data, err = totpdb.ReadCBORSec(s.path, s.pwd.Bytes(), s.salt)
+	if err != nil {
+		s.pwd.Destroy()
+		return nil, fmt.Errorf("error reading TOTP data: %w", err)
+	}
+	s.checkVersion(cmd)
+	s.checkIndex()
+	s.applyUsage()
+	return s, nil
+}
+
+// applyUsage merges the last uses recorded next to the database, see totpdb.Usage.
+// A usage file that can not be read only affects "list --sort used".
+func (s *dbSession) applyUsage() {
+	if usage, err := totpdb.ReadUsage(s.path); err == nil {
+		s.data.ApplyUsage(usage)
+	}
+}
+
+// checkIndex brings the index for shell completion in line with the setting of the
+// database, which older versions did not have. Failing to write it is harmless,
+// completion offers no names then.
+func (s *dbSession) checkIndex() {
+	switch has := totpdb.HasIndex(s.path); {
+	case s.data.CompletionIndex && !has:
+		totpdb.WriteIndex(s.path, s.data)
+	case !s.data.CompletionIndex && has:
+		os.Remove(totpdb.IndexPath(s.path))
+	}
+}
+
+// checkVersion points to the migrate command if the database layout is outdated.
+func (s *dbSession) checkVersion(cmd *cobra.Command) {
+	if s.data.NeedsMigration() && cmd.Name() != "migrate" {
+		conditionalPrintf(getQuiet(cmd), "Database uses an older layout, run \"totp migrate\" to upgrade it\n")
+	}
+}
+
+// save writes the database back with the same password and key slots it was opened with.
+func (s *dbSession) save() error {
+	if err := totpdb.WriteCBORSec(s.path, s.data, s.pwd.Bytes(), s.salt); err != nil {
+		return fmt.Errorf("error writing TOTP data: %w", err)
+	}
+	return nil
+}
+
+// close wipes the password and the database key.
+func (s *dbSession) close() {
+	s.pwd.Destroy()
+	s.data.Close()
+}
+
+// getEntryIndex returns the index of the entry selected by the id flag or by the
+// account and issuer flags. Without any of them, the entry is picked interactively.
+func getEntryIndex(cmd *cobra.Command, data *totpdb.TOTPData) (int, error) {
+	if id, _ := cmd.Flags().GetString(FLAG_ID); id != "" {
+		return data.FindEntryByID(id)
+	}
+	account, _ := cmd.Flags().GetString(FLAG_ACCOUNT)
+	issuer, _ := cmd.Flags().GetString(FLAG_ISSUER)
+	if account == "" && issuer == "" {
+		return pickEntry(data)
+	}
+	return data.FindEntry(account, issuer)
+}
+
+// getQuery returns the query given by the flags added by setQueryFlags.
+func getQuery(cmd *cobra.Command) (totpdb.Query, error) {
+	var q totpdb.Query
+	flags := cmd.Flags()
+	q.Tags, _ = flags.GetStringSlice(FLAG_TAG)
+	q.Group, _ = flags.GetString(FLAG_GROUP)
+	q.Sort, _ = flags.GetString(FLAG_SORT)
+	q.Limit, _ = flags.GetInt(FLAG_LIMIT)
+	exprs, _ := flags.GetStringArray(FLAG_FILTER)
+	for _, expr := range exprs {
+		filters, err := totpdb.ParseFilter(expr)
+		if err != nil {
+			return q, err
+		}
+		q.Filters = append(q.Filters, filters...)
+	}
+	return q, nil
+}
+
+// setQueryFlags adds the flags that select entries and their order for commands working on several entries.
+func setQueryFlags(cmd *cobra.Command, action string) {
+	cmd.Flags().StringSlice(FLAG_TAG, nil, "Only "+action+" TOTPs with these tags, repeat or separate by commas")
+	cmd.Flags().String(FLAG_GROUP, "", "Only "+action+" TOTPs in this group or its subgroups")
+	cmd.Flags().StringArray(FLAG_FILTER, nil, "Only "+action+" TOTPs matching all conditions such as \"issuer~github type=totp\", with the operators =, !=, ~ and !~ on the fields "+strings.Join(totpdb.FilterFields(), ", "))
+	cmd.Flags().String(FLAG_SORT, "", "Sort by "+strings.Join(totpdb.SortKeys, ", ")+" instead of the stored order, prefix by - to reverse")
+	cmd.Flags().Int(FLAG_LIMIT, 0, "At most this many TOTPs")
+}
+
+// setEntryFlags adds the flags that select an entry by id or by account and issuer.
+func setEntryFlags(cmd *cobra.Command, action string) {
+	cmd.Flags().String(FLAG_ID, "", "ID or unique ID prefix of the TOTP to "+action)
+	cmd.Flags().StringP(FLAG_ACCOUNT, "a", "", "Account name of the TOTP to "+action)
+	cmd.Flags().StringP(FLAG_ISSUER, "i", "", "Issuer name of the TOTP to "+action)
+	cmd.MarkFlagsMutuallyExclusive(FLAG_ID, FLAG_ACCOUNT)
+	cmd.MarkFlagsMutuallyExclusive(FLAG_ID, FLAG_ISSUER)
+}
+
 // getQuiet returns the value of the "quiet" flag from the provided command.
 // If the "quiet" flag is set, this function will return true, indicating that
 // the program should run in a quiet mode and suppress non-essential output.
+// Machine-readable output formats imply quiet mode, so that status messages do not mix with the output.
 func getQuiet(cmd *cobra.Command) bool {
 	val, _ := cmd.Flags().GetBool(FLAG_QUIET)
+	return val || getOutput(cmd) != totpdb.FormatTable
+}
+
+// getOutput returns the output format given by the "output" flag.
+func getOutput(cmd *cobra.Command) string {
+	val, _ := cmd.Flags().GetString(FLAG_OUTPUT)
+	if val == "" {
+		return totpdb.FormatTable
+	}
 	return val
 }
 
+// writeCode writes the code of the entry at time t with its validity and the
+// entry metadata in the machine-readable output format of the command.
+func writeCode(cmd *cobra.Command, data *totpdb.TOTPData, ent totpdb.TOTPEntry, t time.Time) error {
+	info, err := data.CodeInfo(ent, t, false)
+	if err != nil {
+		return fmt.Errorf("error generating TOTP: %w", err)
+	}
+	return totpdb.WriteEntry(os.Stdout, getOutput(cmd), info, totpdb.ListOptions{Codes: true})
+}
+
+// expandHome expands a leading `~/` to the user's home directory.
+func expandHome(path string) (string, error) {
+	if len(path) < 2 || path[:2] != "~/" {
+		return path, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, path[2:]), nil
+}
+
 // getDBFilePath returns the database file path, checking command-line flag, environment variable, or default path
 func getDBFilePath(cmd *cobra.Command) string {
+	quiet := getQuiet(cmd)
+
+	dbPath, err := resolveDBPath(cmd)
+	if err != nil {
+		fmt.Println("Error getting user home directory:", err)
+		os.Exit(1)
+	}
+
+	// Create the directory structure if it doesn't exist
+	dir := filepath.Dir(dbPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Println("Error creating directory structure:", err)
+		os.Exit(1)
+	}
+	conditionalPrintf(quiet, "Using database file: %s\n", dbPath)
+
+	return dbPath
+}
+
+// resolveDBPath returns the database file path like getDBFilePath, without creating its directory.
+func resolveDBPath(cmd *cobra.Command) (string, error) {
 	const defaultPath = "~/.config/totp-cli/entries.db"
 
 	// Set up Viper to read environment variables
@@ -99,8 +338,6 @@ func getDBFilePath(cmd *cobra.Command) string {
 	viper.SetEnvPrefix("TOTP")
 	viper.BindEnv("DB_PATH")
 
-	quiet := getQuiet(cmd)
-
 	// Check if the path is provided as a command-line argument
 	var dbPath string
 	if cmd.Flag(FLAG_DB).Changed {
@@ -115,24 +352,7 @@ func getDBFilePath(cmd *cobra.Command) string {
 	}
 
 	// Expand the `~` to the user's home directory
-	if dbPath[:2] == "~/" {
-		homeDir, err := os.UserHomeDir()
-		if err != nil {
-			fmt.Println("Error getting user home directory:", err)
-			os.Exit(1)
-		}
-		dbPath = filepath.Join(homeDir, dbPath[2:])
-	}
-
-	// Create the directory structure if it doesn't exist
-	dir := filepath.Dir(dbPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		fmt.Println("Error creating directory structure:", err)
-		os.Exit(1)
-	}
-	conditionalPrintf(quiet, "Using database file: %s\n", dbPath)
-
-	return dbPath
+	return expandHome(dbPath)
 }
 
 var cmdCreateDb = &cobra.Command{
@@ -145,6 +365,7 @@ var cmdCreateDb = &cobra.Command{
 		dbPath := getDBFilePath(cmd)
 		// Initialize an empty TOTPData
 		data := &totpdb.TOTPData{
+			Version: totpdb.DataVersion,
 			Entries: []totpdb.TOTPEntry{},
 		}
 		// Check if the database file already exists
@@ -156,8 +377,10 @@ var cmdCreateDb = &cobra.Command{
 		if err != nil {
 			return err
 		}
+		defer pwd.Destroy()
+		defer data.Close()
 		// Write the empty database to the specified path
-		err = totpdb.WriteCBORSec(dbPath, data, pwd, salt)
+		err = totpdb.WriteCBORSec(dbPath, data, pwd.Bytes(), salt)
 		if err != nil {
 			return fmt.Errorf("error creating database: %w", err)
 		}
@@ -190,39 +413,21 @@ var cmdAddUrl = &cobra.Command{
 			return fmt.Errorf("error parsing TOPT URL: %w", err)
 		}
 
-		dbFilePath := getDBFilePath(cmd)
-		// Get the password and salt
-		pwd, salt, err := getPwdSalt(cmd)
+		db, err := openDB(cmd)
 		if err != nil {
 			return err
 		}
-		data, err := totpdb.ReadCBORSec(dbFilePath, pwd, salt)
-		if err != nil {
-			return fmt.Errorf("error reading TOTP data: %w", err)
-		}
+		defer db.close()
 
-		if err := data.AddEntry(key); err != nil {
+		warnKey(cmd, key)
+		if err := db.data.AddEntry(key); err != nil {
 			return fmt.Errorf("error adding for %s from %s: %w", key.AccountName(), key.Issuer(), err)
 		}
-		// Write the empty database to the specified path
-		if err := totpdb.WriteCBORSec(dbFilePath, data, pwd, salt); err != nil {
-			return fmt.Errorf("error writing TOTP data: %w", err)
-		}
-
-		quiet := getQuiet(cmd)
-		conditionalPrintf(quiet, "Added TOTP for %s from %s\n", key.AccountName(), key.Issuer())
-		// Generate the TOTP code
-		code, err := totp.GenerateCode(key.Secret(), time.Now())
-		if err != nil {
-			return fmt.Errorf("error generating TOTP code: %w", err)
+		if err := db.save(); err != nil {
+			return err
 		}
 
-		// Print the TOTP code
-		conditionalPrintf(quiet, "Generated TOTP code: ")
-		fmt.Println(code)
-
-		return nil
-
+		return showAdded(cmd, db.data, key)
 	},
 }
 
@@ -230,20 +435,26 @@ var cmdList = &cobra.Command{
 	Use:     "list",
 	Aliases: []string{"l"},
 	Short:   "List all TOTPs",
-	Long:    `List all TOTPs in the database as an ASCII table.`,
+	Long: `List all TOTPs in the database as an ASCII table, or in the format given
+by flag "output".`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		dbPath := getDBFilePath(cmd)
-		// Get the password and salt
-		pwd, salt, err := getPwdSalt(cmd)
+		db, err := openDB(cmd)
 		if err != nil {
 			return err
 		}
-
-		data, err := totpdb.ReadCBORSec(dbPath, pwd, salt)
+		defer db.close()
+		var opts totpdb.ListOptions
+		opts.Codes, _ = cmd.Flags().GetBool(FLAG_CODES)
+		opts.Next, _ = cmd.Flags().GetBool(FLAG_NEXT)
+		opts.Codes = opts.Codes || opts.Next
+		opts.Columns, _ = cmd.Flags().GetStringSlice(FLAG_COLUMNS)
+		opts.Query, err = getQuery(cmd)
 		if err != nil {
-			return fmt.Errorf("error reading TOTP data: %w", err)
+			return fmt.Errorf("error listing TOTPs: %w", err)
+		}
+		if err := db.data.PrintTable(os.Stdout, getOutput(cmd), opts); err != nil {
+			return fmt.Errorf("error listing TOTPs: %w", err)
 		}
-		data.PrintTable()
 
 		return nil
 	},
@@ -253,84 +464,225 @@ var cmdGenerate = &cobra.Command{
 	Use:     "generate",
 	Aliases: []string{"gen", "g"},
 	Short:   "Generate a TOTP",
-	Long:    `Generate a TOTP for the specified account and issuer.`,
+	Long: `Generate a TOTP for the specified id or account and issuer.
+Without them, pick the TOTP interactively: type to filter by fuzzy search over
+issuer and account name, move with the arrow keys and press Enter.
+Codes are generated for the system time corrected by "clock skew", or for the time
+given by flags "at" and "offset"; flag "next" adds the codes of the following steps.
+With flag "min-validity", a code that expires sooner is not printed; the command
+waits for the code of the next period instead.
+HOTP entries give the code of their counter, which is advanced and saved before the
+code is printed; the flags about time do not apply to them.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		account, _ := cmd.Flags().GetString(FLAG_ACCOUNT)
-		issuer, _ := cmd.Flags().GetString(FLAG_ISSUER)
-		publish, _ := cmd.Flags().GetBool(FLAG_CLIP)
-
-		dbFilePath := getDBFilePath(cmd)
-		// Get the password and salt
-		pwd, salt, err := getPwdSalt(cmd)
+		db, err := openDB(cmd)
 		if err != nil {
 			return err
 		}
-		data, err := totpdb.ReadCBORSec(dbFilePath, pwd, salt)
+		defer db.close()
+
+		ind, err := getEntryIndex(cmd, db.data)
 		if err != nil {
-			return fmt.Errorf("error reading TOTP data: %w", err)
+			return fmt.Errorf("error selecting TOTP: %w", err)
 		}
-
-		val, err := data.GetEntry(account, issuer)
+		// Decrypt the secret of the selected entry only
+		val, err := db.data.RevealEntry(db.data.Entries[ind])
 		if err != nil {
-			return fmt.Errorf("account not found: %w", err)
+			return fmt.Errorf("error decrypting TOTP secret: %w", err)
 		}
 
-		code, err := totp.GenerateCode(val.Secret, time.Now())
+		if val.Type == totpdb.TypeHOTP {
+			code, err := generateHOTP(cmd, db, ind, val)
+			if err != nil {
+				return err
+			}
+			return deliverCode(cmd, val, code, 0)
+		}
+
+		t, err := getCodeTime(cmd, db.data)
 		if err != nil {
-			return fmt.Errorf("error generating TOTP: %w", err)
+			return err
 		}
+		quiet := getQuiet(cmd)
+		minValidity, _ := cmd.Flags().GetDuration(FLAG_MIN_VALIDITY)
+		if minValidity > 0 {
+			fresh, err := val.FreshAt(t, minValidity)
+			if err != nil {
+				return err
+			}
+			if fresh.After(t) && !cmd.Flags().Changed(FLAG_AT) {
+				// Wait for the next period instead of printing a code about to expire
+				conditionalPrintf(quiet, "Waiting %s for a fresh code\n", fresh.Sub(t).Round(time.Millisecond))
+				time.Sleep(fresh.Sub(t))
+				if t, err = getCodeTime(cmd, db.data); err != nil {
+					return err
+				}
+			} else {
+				t = fresh
+			}
+		}
+		next, _ := cmd.Flags().GetInt(FLAG_NEXT)
+		if next < 0 {
+			return fmt.Errorf("number of next codes must not be negative, not %d", next)
+		}
+		steps := val.Steps(t, next)
+		codes := make([]string, len(steps))
+		for i, step := range steps {
+			if codes[i], err = val.GenerateCode(step); err != nil {
+				return fmt.Errorf("error generating TOTP: %w", err)
+			}
+		}
+		code := codes[0]
 
 		// Print the TOTP code
-		quiet := getQuiet(cmd)
-		if quiet {
-			fmt.Println(code)
-		} else {
+		format := getOutput(cmd)
+		switch {
+		case format != totpdb.FormatTable && next > 0:
+			infos := make([]totpdb.EntryInfo, len(steps))
+			for i, step := range steps {
+				if infos[i], err = db.data.CodeInfo(val, step, false); err != nil {
+					return fmt.Errorf("error generating TOTP: %w", err)
+				}
+			}
+			if err := totpdb.WriteEntries(os.Stdout, format, infos, totpdb.ListOptions{Codes: true}); err != nil {
+				return err
+			}
+		case format != totpdb.FormatTable:
+			if err := writeCode(cmd, db.data, val, t); err != nil {
+				return err
+			}
+		case quiet:
+			fmt.Println(strings.Join(codes, "\n"))
+		default:
 			conditionalPrintf(quiet, "TOTP for %s from %s: %s\n",
 				val.AccountName, val.Issuer, code)
-		}
-		if publish {
-			err = clipboard.WriteAll(code)
-			if err != nil {
-				return fmt.Errorf("error writing to clipboard: %w", err)
+			if minValidity > 0 {
+				conditionalPrintf(quiet, "Valid for %s\n", val.Remaining(t).Round(time.Second))
 			}
-			conditionalPrintf(quiet, "Copied TOTP code to clipboard\n")
+			for i, step := range steps[1:] {
+				conditionalPrintf(quiet, "Valid from %s: %s\n", step.Format(time.TimeOnly), codes[i+1])
+			}
+		}
+		if err := deliverCode(cmd, val, code, val.Remaining(t)); err != nil {
+			return err
 		}
 
+		// Remember the use for "list --sort used" without rewriting the database;
+		// the code is out already, so failing to record it must not fail the command
+		if err := db.data.RecordUse(db.path, ind); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: error saving the last use: %s\n", err)
+		}
 		return nil
 	},
 }
 
+// generateHOTP generates the code of the HOTP entry at index and saves the advanced
+// counter before the code is printed, so that the code is never handed out twice.
+func generateHOTP(cmd *cobra.Command, db *dbSession, ind int, ent totpdb.TOTPEntry) (string, error) {
+	for _, name := range []string{FLAG_AT, FLAG_OFFSET, FLAG_SKEW, FLAG_NEXT, FLAG_MIN_VALIDITY} {
+		if cmd.Flags().Changed(name) {
+			return "", fmt.Errorf("flag %q does not apply to HOTP entries", name)
+		}
+	}
+	code, err := db.data.HOTPCode(ent)
+	if err != nil {
+		return "", fmt.Errorf("error generating HOTP: %w", err)
+	}
+	db.data.AdvanceCounter(ind)
+	db.data.MarkUsed(ind)
+	if err := db.save(); err != nil {
+		return "", fmt.Errorf("error saving the HOTP counter: %w", err)
+	}
+
+	if format := getOutput(cmd); format != totpdb.FormatTable {
+		info := ent.Info()
+		info.Code = code
+		return code, totpdb.WriteEntry(os.Stdout, format, info, totpdb.ListOptions{Codes: true})
+	}
+	if getQuiet(cmd) {
+		fmt.Println(code)
+	} else {
+		fmt.Printf("HOTP for %s from %s: %s (counter %d)\n", ent.AccountName, ent.Issuer, code, ent.Counter)
+	}
+	return code, nil
+}
+
+// deliverCode copies, types and shows in a notification the code of the entry as the
+// flags of generate request. remaining is how long the code stays valid, zero if it does not expire.
+func deliverCode(cmd *cobra.Command, ent totpdb.TOTPEntry, code string, remaining time.Duration) error {
+	quiet := getQuiet(cmd)
+	publish, _ := cmd.Flags().GetBool(FLAG_CLIP)
+	if publish {
+		selection, _ := cmd.Flags().GetString(FLAG_SELECTION)
+		clearAfter, err := getClearAfter()
+		if err != nil {
+			return err
+		}
+		if err := copyCode(code, selection, clearAfter); err != nil {
+			return err
+		}
+		if clearAfter > 0 {
+			conditionalPrintf(quiet, "Copied TOTP code to %s, clearing it in %s\n", selection, clearAfter)
+		} else {
+			conditionalPrintf(quiet, "Copied TOTP code to %s\n", selection)
+		}
+	}
+
+	if typeCode, _ := cmd.Flags().GetBool(FLAG_TYPE_CODE); typeCode {
+		delay, _ := cmd.Flags().GetDuration(FLAG_TYPE_DELAY)
+		enter, _ := cmd.Flags().GetBool(FLAG_ENTER)
+		if err := typeOut(code, delay, enter); err != nil {
+			return err
+		}
+		conditionalPrintf(quiet, "Typed TOTP code\n")
+	}
+
+	if notify, _ := cmd.Flags().GetBool(FLAG_NOTIFY); notify {
+		notifyCode(dbusNotifier{}, os.Stderr, ent.AccountName, ent.Issuer, code, publish, remaining)
+	}
+	return nil
+}
+
 var cmdRremove = &cobra.Command{
 	Use:     "remove",
 	Aliases: []string{"rm"},
-	Short:   "Remove a TOTP by account and issuer",
-	Long:    `Remove a TOTP by account and issuer.`,
+	Short:   "Remove a TOTP by id or account and issuer, or all TOTPs matching a query",
+	Long: `Remove a TOTP by id or account and issuer.
+With flags "filter", "tag", "group" or "all-from-issuer", remove all matching TOTPs
+at once: they are listed first and removed after confirmation, or right away with
+flag "yes".`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		account, _ := cmd.Flags().GetString(FLAG_ACCOUNT)
-		issuer, _ := cmd.Flags().GetString("issuer")
-
-		dbFilePath := getDBFilePath(cmd)
-		// Get the password and salt
-		pwd, salt, err := getPwdSalt(cmd)
+		if err := checkBulkFlags(cmd); err != nil {
+			return err
+		}
+		db, err := openDB(cmd)
 		if err != nil {
 			return err
 		}
+		defer db.close()
 
-		data, err := totpdb.ReadCBORSec(dbFilePath, pwd, salt)
-		if err != nil {
-			return fmt.Errorf("error reading TOTP data: %w", err)
+		if isBulk(cmd) {
+			return removeSelected(cmd, db)
 		}
 
-		if err := data.RemoveEntry(account, issuer); err != nil {
+		ind, err := getEntryIndex(cmd, db.data)
+		if err != nil {
+			return fmt.Errorf("error removing TOTP: %w", err)
+		}
+		removed, err := db.data.RemoveEntries([]int{ind})
+		if err != nil {
 			return fmt.Errorf("error removing TOTP: %w", err)
 		}
 
-		if err := totpdb.WriteCBORSec(dbFilePath, data, pwd, salt); err != nil {
-			return fmt.Errorf("error writing TOTP data: %w", err)
+		if err := db.save(); err != nil {
+			return err
 		}
 
+		if format := getOutput(cmd); format != totpdb.FormatTable {
+			trashed := db.data.Trash[len(db.data.Trash)-1]
+			return totpdb.WriteEntry(os.Stdout, format, db.data.TrashInfo(trashed), totpdb.ListOptions{Columns: trashColumns})
+		}
 		quiet := getQuiet(cmd)
-		conditionalPrintf(quiet, "Removed TOTP for %s from %s\n", account, issuer)
+		conditionalPrintf(quiet, "Moved TOTP for %s from %s to the trash, see \"totp trash\"\n", removed[0].AccountName, removed[0].Issuer)
 
 		return nil
 	},
@@ -377,55 +729,38 @@ var cmdAddQRC = &cobra.Command{
 			return fmt.Errorf("error parsing TOTP URL: %w", err)
 		}
 
-		// Generate the TOTP code
-		code, err := totp.GenerateCode(key.Secret(), time.Now())
-		if err != nil {
-			return fmt.Errorf("error generating TOTP code: %w", err)
-		}
-
-		quiet := getQuiet(cmd)
-		// Print the TOTP code
-		conditionalPrintf(quiet, "Generated TOTP code: ")
-		fmt.Println(code)
-
-		dbFilePath := getDBFilePath(cmd)
-		// Get the password and salt
-		pwd, salt, err := getPwdSalt(cmd)
-		if err != nil {
-			return err
-		}
-
 		// Add the TOTP to the database
-		data, err := totpdb.ReadCBORSec(dbFilePath, pwd, salt)
+		db, err := openDB(cmd)
 		if err != nil {
-			return fmt.Errorf("error reading TOTP data: %w", err)
+			return err
 		}
-		if err := data.AddEntry(key); err != nil {
+		defer db.close()
+		warnKey(cmd, key)
+		if err := db.data.AddEntry(key); err != nil {
 			return fmt.Errorf("error adding for %s from %s: %w", key.AccountName(), key.Issuer(), err)
 		}
 
-		if err := totpdb.WriteCBORSec(dbFilePath, data, pwd, salt); err != nil {
-			return fmt.Errorf("error writing TOTP data: %w", err)
+		if err := db.save(); err != nil {
+			return err
 		}
 
-		conditionalPrintf(quiet, "Added TOTP for %s from %s\n", key.AccountName(), key.Issuer())
-
-		return nil
+		return showAdded(cmd, db.data, key)
 	},
 }
 
 var rootCmd = &cobra.Command{
 	Use:   "totp",
 	Short: "TOTP CLI app",
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
 		quiet := getQuiet(cmd)
 		cmd.SilenceUsage = quiet
 		cmd.SilenceErrors = quiet
+		return totpdb.CheckFormat(getOutput(cmd))
 	},
 }
 
 func setCobraCommands() {
-	rootCmd.AddCommand(cmdAddUrl, cmdList, cmdGenerate, cmdRremove, cmdAddQRC, cmdCreateDb)
+	rootCmd.AddCommand(cmdAdd, cmdAddUrl, cmdList, cmdGenerate, cmdRremove, cmdAddQRC, cmdCreateDb, cmdRecipients, cmdRecovery, cmdMigrate, cmdEdit, cmdWatch, cmdTag, cmdTrash, cmdVerify, cmdClock, cmdClearClipboard, cmdCompletion)
 
 	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Suppress output")
 	viper.BindPFlag("quiet", rootCmd.PersistentFlags().Lookup("quiet"))
@@ -435,6 +770,10 @@ func setCobraCommands() {
 	rootCmd.PersistentFlags().StringP(FLAG_SALT, "s", "", "Salt input for encryption or, if not set in, environment variable TOTP_SALT or default value")
 	viper.BindPFlag(FLAG_SALT, rootCmd.PersistentFlags().Lookup(FLAG_SALT))
 	viper.SetDefault(FLAG_SALT, os.Getenv("TOTP_SALT"))
+	rootCmd.PersistentFlags().String(FLAG_IDENTITY, "", "Age identity file to unlock the database instead of the password, if not set in, environment variable TOTP_IDENTITY")
+	viper.BindPFlag(FLAG_IDENTITY, rootCmd.PersistentFlags().Lookup(FLAG_IDENTITY))
+	viper.SetDefault(FLAG_IDENTITY, os.Getenv("TOTP_IDENTITY"))
+	rootCmd.PersistentFlags().StringP(FLAG_OUTPUT, "o", totpdb.FormatTable, "Output format: "+strings.Join(totpdb.Formats, ", "))
 
 	cmdAddUrl.Flags().StringP(FLAG_URL, "u", "", "OTP URL to add. It must be in \"\".")
 	cmdAddUrl.Flags().BoolP(FLAG_CLIP, "c", false, "Read OTP URL from clipboard")
@@ -442,21 +781,42 @@ func setCobraCommands() {
 	cmdAddQRC.Flags().StringP(FLAG_IMAGE, "i", "", "Read OTP image from file")
 	cmdAddQRC.MarkFlagRequired(FLAG_IMAGE)
 
-	cmdGenerate.Flags().StringP(FLAG_ACCOUNT, "a", "", "Account name to generate TOTP for")
-	cmdGenerate.Flags().StringP(FLAG_ISSUER, "i", "", "Issuer name to generate TOTP for")
-	cmdGenerate.Flags().BoolP(FLAG_CLIP, "c", false, "Put code to clipboard")
-	cmdGenerate.MarkFlagRequired(FLAG_ACCOUNT)
+	cmdList.Flags().Bool(FLAG_CODES, false, "Show the current code of every TOTP and how long it stays valid")
+	cmdList.Flags().Bool(FLAG_NEXT, false, "Also show the code of the following period, implies --codes")
+	cmdList.Flags().StringSlice(FLAG_COLUMNS, nil, "Columns of tables, CSV and TSV, separated by commas: "+strings.Join(totpdb.ColumnKeys(), ", "))
+	setQueryFlags(cmdList, "list")
 
-	cmdRremove.Flags().StringP(FLAG_ACCOUNT, "a", "", "Account name to remove TOTP for")
-	cmdRremove.Flags().StringP(FLAG_ISSUER, "i", "", "Issuer name to remove TOTP for")
-	cmdRremove.MarkFlagRequired(FLAG_ACCOUNT)
+	setEntryFlags(cmdGenerate, "generate")
+	cmdGenerate.Flags().BoolP(FLAG_CLIP, "c", false, "Put code to clipboard")
 
+	setEntryFlags(cmdRremove, "remove")
+	setBulkFlags(cmdRremove, "remove")
+	cmdRremove.MarkFlagsOneRequired(append([]string{FLAG_ID, FLAG_ACCOUNT}, bulkFlags...)...)
+
+	setAddCommands()
+	setRecipientsCommands()
+	setRecoveryCommands()
+	setEditCommands()
+	setWatchCommands()
+	setTagCommands()
+	setTrashCommands()
+	setVerifyCommands()
+	setClockCommands()
+	setClipboardCommands()
+	setTyperCommands()
+	setNotifyCommands()
+	// Last, as it completes the flags added above
+	setCompletionCommands()
 }
 
 func main() {
+	if err := totpdb.DisableCoreDumps(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error disabling core dumps:", err)
+	}
 	setCobraCommands()
 
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
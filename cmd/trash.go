@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"bksworm/totpcli/totpdb"
+)
+
+// retentionNever is the retention that keeps removed TOTPs in the trash for ever.
+const retentionNever = "never"
+
+// retentionResult is the result of "trash retention" in machine-readable formats.
+type retentionResult struct {
+	// Retention is formatted as parseRetention accepts it, e.g. "30d" or "never".
+	Retention string `json:"retention" yaml:"retention"`
+}
+
+// trashColumns are the columns of the trash list.
+var trashColumns = []string{"id", "issuer", "account_name", "group", "tags", "deleted", "purge_at"}
+
+var cmdTrash = &cobra.Command{
+	Use:   "trash",
+	Short: "List, restore or delete removed TOTPs",
+	Long: `Removed TOTPs are kept in the encrypted trash of the database, so that a seed
+removed by mistake can be restored. They are deleted for good once they are in the
+trash for longer than the retention, 30 days unless set by "trash retention".`,
+}
+
+var cmdTrashList = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"l"},
+	Short:   "List the TOTPs in the trash",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openDB(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.close()
+
+		infos := make([]totpdb.EntryInfo, len(db.data.Trash))
+		for i, t := range db.data.Trash {
+			infos[i] = db.data.TrashInfo(t)
+		}
+		return totpdb.WriteEntries(os.Stdout, getOutput(cmd), infos, totpdb.ListOptions{Columns: trashColumns})
+	},
+}
+
+var cmdTrashRestore = &cobra.Command{
+	Use:   "restore ID...",
+	Short: "Restore TOTPs from the trash by id or unique id prefix",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openDB(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.close()
+
+		quiet := getQuiet(cmd)
+		for _, id := range args {
+			ind, err := db.data.FindTrashedByID(id)
+			if err != nil {
+				return fmt.Errorf("error restoring TOTP %s: %w", id, err)
+			}
+			ent, err := db.data.RestoreEntry(ind)
+			if err != nil {
+				return fmt.Errorf("error restoring TOTP %s: %w", id, err)
+			}
+			conditionalPrintf(quiet, "Restored TOTP for %s from %s\n", ent.AccountName, ent.Issuer)
+		}
+		return db.save()
+	},
+}
+
+var cmdTrashEmpty = &cobra.Command{
+	Use:   "empty",
+	Short: "Delete all TOTPs in the trash for good",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openDB(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.close()
+
+		quiet := getQuiet(cmd)
+		if len(db.data.Trash) == 0 {
+			conditionalPrintf(quiet, "The trash is empty\n")
+			return nil
+		}
+		infos := make([]totpdb.EntryInfo, len(db.data.Trash))
+		for i, t := range db.data.Trash {
+			infos[i] = db.data.TrashInfo(t)
+		}
+		question := fmt.Sprintf("Delete %d TOTPs for good? Their seeds can not be restored.", len(infos))
+		ok, err := confirm(cmd, infos, totpdb.ListOptions{Columns: trashColumns}, question)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			conditionalPrintf(quiet, "Nothing deleted\n")
+			return nil
+		}
+
+		n := db.data.EmptyTrash()
+		if err := db.save(); err != nil {
+			return err
+		}
+		conditionalPrintf(quiet, "Deleted %d TOTPs\n", n)
+		return nil
+	},
+}
+
+var cmdTrashRetention = &cobra.Command{
+	Use:   "retention [DURATION]",
+	Short: "Show or set how long removed TOTPs stay in the trash",
+	Long: `Show or set how long removed TOTPs stay in the trash before they are deleted
+for good. DURATION is given in days like "90d", as a Go duration like "48h",
+or as "never" to keep them until "trash empty".`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		db, err := openDB(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.close()
+
+		format := getOutput(cmd)
+		if len(args) == 0 {
+			if format != totpdb.FormatTable {
+				return totpdb.WriteValue(os.Stdout, format, retentionResult{Retention: formatRetention(db.data.TrashRetention)})
+			}
+			fmt.Println(formatRetention(db.data.TrashRetention))
+			return nil
+		}
+		retention, err := parseRetention(args[0])
+		if err != nil {
+			return fmt.Errorf("error setting retention: %w", err)
+		}
+		db.data.TrashRetention = retention
+		if err := db.save(); err != nil {
+			return err
+		}
+		if format != totpdb.FormatTable {
+			return totpdb.WriteValue(os.Stdout, format, retentionResult{Retention: formatRetention(retention)})
+		}
+		conditionalPrintf(getQuiet(cmd), "Removed TOTPs are kept for %s\n", formatRetention(retention))
+		return nil
+	},
+}
+
+// parseRetention parses a retention given in days, as a Go duration or as "never".
+func parseRetention(s string) (time.Duration, error) {
+	if s == retentionNever {
+		return -1, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("invalid number of days %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("retention must be positive or %q", retentionNever)
+	}
+	return d, nil
+}
+
+// formatRetention formats a retention as parseRetention accepts it.
+func formatRetention(d time.Duration) string {
+	switch {
+	case d < 0:
+		return retentionNever
+	case d == 0:
+		d = totpdb.DefaultTrashRetention
+	}
+	if d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return d.String()
+}
+
+func setTrashCommands() {
+	cmdTrash.AddCommand(cmdTrashList, cmdTrashRestore, cmdTrashEmpty, cmdTrashRetention)
+	cmdTrashEmpty.Flags().BoolP(FLAG_YES, "y", false, "Do not ask for confirmation")
+}
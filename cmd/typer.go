@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+const (
+	FLAG_TYPE_CODE  = "type"
+	FLAG_TYPE_DELAY = "type-delay"
+	FLAG_ENTER      = "enter"
+)
+
+var errNoTyper = errors.New("no tool to type keystrokes found, install xdotool, wtype or ydotool")
+
+// typer types text into the focused window.
+type typer interface {
+	// Type types the text with delay between the keystrokes and, if enter is set, presses Enter.
+	Type(text string, delay time.Duration, enter bool) error
+}
+
+// xdotoolTyper types with xdotool on X11.
+type xdotoolTyper struct{}
+
+func (xdotoolTyper) Type(text string, delay time.Duration, enter bool) error {
+	if err := exec.Command("xdotool", "type", "--delay", delayMillis(delay), "--", text).Run(); err != nil {
+		return err
+	}
+	if enter {
+		return exec.Command("xdotool", "key", "Return").Run()
+	}
+	return nil
+}
+
+// wtypeTyper types with wtype on Wayland compositors supporting the virtual keyboard protocol.
+type wtypeTyper struct{}
+
+func (wtypeTyper) Type(text string, delay time.Duration, enter bool) error {
+	// Codes are digits, which wtype can not mistake for options
+	args := []string{"-d", delayMillis(delay), text}
+	if enter {
+		args = append(args, "-k", "Return")
+	}
+	return exec.Command("wtype", args...).Run()
+}
+
+// ydotoolTyper types with ydotool through the uinput device, on X11 and Wayland.
+type ydotoolTyper struct{}
+
+func (ydotoolTyper) Type(text string, delay time.Duration, enter bool) error {
+	if enter {
+		text += "\n"
+	}
+	return exec.Command("ydotool", "type", "--key-delay", delayMillis(delay), "--", text).Run()
+}
+
+// delayMillis formats a delay in milliseconds as the typing tools expect it.
+func delayMillis(delay time.Duration) string {
+	return strconv.FormatInt(delay.Milliseconds(), 10)
+}
+
+// typers are the typing tools by name.
+var typers = map[string]typer{
+	"xdotool": xdotoolTyper{},
+	"wtype":   wtypeTyper{},
+	"ydotool": ydotoolTyper{},
+}
+
+// newTyper returns the typer of the session; tests replace it.
+var newTyper = findTyper
+
+// findTyper returns the first installed typing tool, wtype on Wayland and xdotool on X11,
+// falling back to ydotool, which also works without a display server.
+func findTyper() (typer, error) {
+	var tools []string
+	switch {
+	case os.Getenv("WAYLAND_DISPLAY") != "":
+		tools = []string{"wtype", "ydotool"}
+	case os.Getenv("DISPLAY") != "":
+		tools = []string{"xdotool", "ydotool"}
+	default:
+		tools = []string{"ydotool"}
+	}
+	for _, tool := range tools {
+		if _, err := exec.LookPath(tool); err == nil {
+			return typers[tool], nil
+		}
+	}
+	return nil, errNoTyper
+}
+
+// typeOut types the code into the focused window with the typer of the session.
+func typeOut(code string, delay time.Duration, enter bool) error {
+	tp, err := newTyper()
+	if err != nil {
+		return err
+	}
+	if err := tp.Type(code, delay, enter); err != nil {
+		return fmt.Errorf("error typing TOTP code: %w", err)
+	}
+	return nil
+}
+
+func setTyperCommands() {
+	cmdGenerate.Flags().Bool(FLAG_TYPE_CODE, false, "Type the code into the focused window with xdotool, wtype or ydotool")
+	cmdGenerate.Flags().Duration(FLAG_TYPE_DELAY, 12*time.Millisecond, "Delay between the typed keystrokes")
+	cmdGenerate.Flags().Bool(FLAG_ENTER, false, "Press Enter after typing the code")
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeTools installs scripts named like the tools into an empty PATH; they write
+// their arguments, one per line, to a file named after the tool in the same directory.
+func fakeTools(t *testing.T, tools ...string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake tools are shell scripts")
+	}
+	dir := t.TempDir()
+	for _, tool := range tools {
+		script := "#!/bin/sh\nprintf '%s\\n' \"$@\" >> \"${0%/*}/" + tool + ".args\"\n"
+		if err := os.WriteFile(filepath.Join(dir, tool), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+	return dir
+}
+
+// toolArgs returns the arguments the fake tool was called with.
+func toolArgs(t *testing.T, dir, tool string) []string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join(dir, tool+".args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+}
+
+func TestFindTyper(t *testing.T) {
+	all := []string{"xdotool", "wtype", "ydotool"}
+	tests := []struct {
+		name    string
+		wayland string
+		display string
+		tools   []string
+		want    typer
+	}{
+		{"x11", "", ":0", all, xdotoolTyper{}},
+		{"wayland", "wayland-0", ":0", all, wtypeTyper{}},
+		{"x11 without xdotool", "", ":0", []string{"wtype", "ydotool"}, ydotoolTyper{}},
+		{"wayland without wtype", "wayland-0", "", []string{"xdotool", "ydotool"}, ydotoolTyper{}},
+		{"console", "", "", all, ydotoolTyper{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeTools(t, tt.tools...)
+			t.Setenv("WAYLAND_DISPLAY", tt.wayland)
+			t.Setenv("DISPLAY", tt.display)
+			got, err := findTyper()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %T, want %T", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindTyperNoTool(t *testing.T) {
+	// Only tools for another display server are installed
+	tests := []struct {
+		name    string
+		wayland string
+		display string
+		tools   []string
+	}{
+		{"x11", "", ":0", []string{"wtype"}},
+		{"wayland", "wayland-0", "", []string{"xdotool"}},
+		{"console", "", "", []string{"xdotool", "wtype"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeTools(t, tt.tools...)
+			t.Setenv("WAYLAND_DISPLAY", tt.wayland)
+			t.Setenv("DISPLAY", tt.display)
+			if _, err := findTyper(); !errors.Is(err, errNoTyper) {
+				t.Errorf("got error %v, want %v", err, errNoTyper)
+			}
+		})
+	}
+}
+
+func TestTyperArgs(t *testing.T) {
+	tests := []struct {
+		tool  string
+		typer typer
+		enter bool
+		want  []string
+	}{
+		{"xdotool", xdotoolTyper{}, false, []string{"type", "--delay", "25", "--", "123456"}},
+		{"xdotool", xdotoolTyper{}, true, []string{"type", "--delay", "25", "--", "123456", "key", "Return"}},
+		{"wtype", wtypeTyper{}, false, []string{"-d", "25", "123456"}},
+		{"wtype", wtypeTyper{}, true, []string{"-d", "25", "123456", "-k", "Return"}},
+		{"ydotool", ydotoolTyper{}, false, []string{"type", "--key-delay", "25", "--", "123456"}},
+		{"ydotool", ydotoolTyper{}, true, []string{"type", "--key-delay", "25", "--", "123456", ""}},
+	}
+	for _, tt := range tests {
+		dir := fakeTools(t, tt.tool)
+		if err := tt.typer.Type("123456", 25*time.Millisecond, tt.enter); err != nil {
+			t.Fatalf("%s: %v", tt.tool, err)
+		}
+		if got := toolArgs(t, dir, tt.tool); strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%s enter=%t: got arguments %q, want %q", tt.tool, tt.enter, got, tt.want)
+		}
+	}
+}
+
+// recordingTyper records the typed text.
+type recordingTyper struct {
+	text  string
+	enter bool
+	err   error
+}
+
+func (r *recordingTyper) Type(text string, delay time.Duration, enter bool) error {
+	r.text, r.enter = text, enter
+	return r.err
+}
+
+func TestTypeOut(t *testing.T) {
+	var rec recordingTyper
+	defer func(orig func() (typer, error)) { newTyper = orig }(newTyper)
+	newTyper = func() (typer, error) { return &rec, nil }
+
+	if err := typeOut("123456", 0, true); err != nil {
+		t.Fatal(err)
+	}
+	if rec.text != "123456" || !rec.enter {
+		t.Errorf("typed %q with enter=%t", rec.text, rec.enter)
+	}
+
+	rec.err = errors.New("no display")
+	if err := typeOut("123456", 0, false); err == nil || !strings.Contains(err.Error(), "no display") {
+		t.Errorf("got error %v", err)
+	}
+
+	newTyper = func() (typer, error) { return nil, errNoTyper }
+	if err := typeOut("123456", 0, false); !errors.Is(err, errNoTyper) {
+		t.Errorf("got error %v, want %v", err, errNoTyper)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"bksworm/totpcli/totpdb"
+)
+
+const FLAG_WINDOW = "window"
+
+var cmdVerify = &cobra.Command{
+	Use:     "verify CODE",
+	Aliases: []string{"v"},
+	Short:   "Verify a code against a TOTP by id or account and issuer",
+	Long: `Verify a code against a TOTP with its digits, period and algorithm, e.g. to test
+a server-side 2FA integration. TOTP codes are accepted for the current time step and
+the number of steps before and after it given by flag "window"; HOTP codes for the
+stored counter and that many counters after it. The matching step or counter is
+reported. A code that does not match makes the command exit with a non-zero status.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		code := strings.Join(strings.Fields(args[0]), "")
+		window, _ := cmd.Flags().GetInt(FLAG_WINDOW)
+
+		db, err := openDB(cmd)
+		if err != nil {
+			return err
+		}
+		defer db.close()
+
+		ind, err := getEntryIndex(cmd, db.data)
+		if err != nil {
+			return fmt.Errorf("error selecting TOTP: %w", err)
+		}
+		ent := db.data.Entries[ind]
+
+		res, err := db.data.VerifyCode(ent, code, db.data.Now(), window)
+		if err != nil && !errors.Is(err, totpdb.ErrCodeMismatch) {
+			return fmt.Errorf("error verifying code: %w", err)
+		}
+		if format := getOutput(cmd); format != totpdb.FormatTable {
+			if werr := totpdb.WriteValue(os.Stdout, format, res); werr != nil {
+				return werr
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("code %s for %s from %s: %w within a window of %d", code, ent.AccountName, ent.Issuer, err, window)
+		}
+
+		quiet := getQuiet(cmd)
+		if ent.Type == totpdb.TypeHOTP {
+			conditionalPrintf(quiet, "Code matches counter %d (stored counter %+d)\n", res.Counter, res.Offset)
+			return nil
+		}
+		conditionalPrintf(quiet, "Code matches time step %d (current step %+d), valid from %s until %s\n",
+			res.Step, res.Offset, res.ValidFrom.Format(time.TimeOnly), res.ValidUntil.Format(time.TimeOnly))
+		return nil
+	},
+}
+
+func setVerifyCommands() {
+	setEntryFlags(cmdVerify, "verify against")
+	cmdVerify.MarkFlagsOneRequired(FLAG_ID, FLAG_ACCOUNT)
+	cmdVerify.Flags().Int(FLAG_WINDOW, 1, "Number of time steps before and after the current one, or of HOTP counters after the stored one, to accept")
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+
+	"bksworm/totpcli/totpdb"
+)
+
+const (
+	FLAG_LOCK_AFTER = "lock-after"
+	// watchBarWidth is the width of the countdown bars.
+	watchBarWidth = 15
+	// watchHeaderRows is the number of screen rows that are not entries.
+	watchHeaderRows = 5
+	// maxPasswordLen is the size of the buffer the password is typed into when unlocking.
+	maxPasswordLen = 256
+)
+
+// watcher is the state of the full-screen dashboard of the watch command.
+type watcher struct {
+	picker
+	cmd      *cobra.Command
+	db       *dbSession
+	fd       int
+	locked   bool
+	password *totpdb.Secret // typed while locked
+	typed    int
+	status   string
+}
+
+var cmdWatch = &cobra.Command{
+	Use:     "watch",
+	Aliases: []string{"w"},
+	Short:   "Show all current codes in a full-screen dashboard",
+	Long: `Show all TOTPs with their current codes and countdowns in a full-screen dashboard.
+Type to filter by fuzzy search, move with the arrow keys, press Enter to copy the
+selected code to the clipboard and Esc or Ctrl-C to quit. The dashboard locks
+itself after the time given by flag "lock-after" without a key press, or never if it is 0.
+Unlocking always takes the password of the database, also when it was opened with an
+identity file, so databases without a password can only be watched with "lock-after" 0.
+HOTP entries show their counter; Enter copies the code of the counter and saves
+the advanced counter.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		lockAfter, _ := cmd.Flags().GetDuration(FLAG_LOCK_AFTER)
+		if lockAfter < 0 {
+			return fmt.Errorf("time to lock after must not be negative, not %s", lockAfter)
+		}
+
+		fd := int(os.Stdin.Fd())
+		if !term.IsTerminal(fd) {
+			return fmt.Errorf("watch needs a terminal")
+		}
+
+		db, err := openDB(cmd)
+		if err != nil {
+			return err
+		}
+		w := &watcher{picker: picker{data: db.data, out: os.Stdout}, cmd: cmd, db: db, fd: fd}
+		defer func() { w.db.close() }()
+		if lockAfter > 0 && !db.data.HasPassword() {
+			return fmt.Errorf("the database has no password to unlock the dashboard with, use --%s 0", FLAG_LOCK_AFTER)
+		}
+		w.filter()
+
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer term.Restore(fd, state)
+		// Switch to the alternate screen and hide the cursor
+		fmt.Fprint(w.out, "\x1b[?1049h\x1b[?25l")
+		defer fmt.Fprint(w.out, "\x1b[?25h\x1b[?1049l")
+
+		keys := make(chan []byte)
+		go func() {
+			defer close(keys)
+			for {
+				buf := make([]byte, 16)
+				n, err := os.Stdin.Read(buf)
+				if err != nil {
+					return
+				}
+				keys <- buf[:n]
+			}
+		}()
+
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		// Without a time to lock after, idle stays nil and never fires
+		var idle <-chan time.Time
+		var idleTimer *time.Timer
+		if lockAfter > 0 {
+			idleTimer = time.NewTimer(lockAfter)
+			defer idleTimer.Stop()
+			idle = idleTimer.C
+		}
+
+		for {
+			w.render(w.data.Now())
+			select {
+			case in, ok := <-keys:
+				if !ok {
+					return nil
+				}
+				if idleTimer != nil {
+					idleTimer.Reset(lockAfter)
+				}
+				quit, err := w.handleKeys(in)
+				if err != nil || quit {
+					return err
+				}
+			case <-ticker.C:
+			case <-idle:
+				w.lock()
+			}
+		}
+	},
+}
+
+// handleKeys processes the input read from the terminal. It reports true to quit.
+func (w *watcher) handleKeys(in []byte) (bool, error) {
+	if w.locked {
+		return w.handleLocked(in)
+	}
+	done, err := w.handle(in)
+	if errors.Is(err, errPickCanceled) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if done {
+		w.copySelected()
+	}
+	return false, nil
+}
+
+// copySelected copies the current code of the selected entry to the clipboard.
+func (w *watcher) copySelected() {
+	ind := w.matches[w.selected].Index
+	ent := w.data.Entries[ind]
+	var code string
+	var err error
+	if ent.Type == totpdb.TypeHOTP {
+		code, err = w.nextHOTPCode(ent.ID)
+	} else {
+		code, err = w.data.GenerateCode(ent, w.data.Now())
+	}
+	if err == nil {
+		var clearAfter time.Duration
+		if clearAfter, err = getClearAfter(); err == nil {
+			err = copyCode(code, selectionClipboard, clearAfter)
+		}
+	}
+	if err != nil {
+		w.status = fmt.Sprintf("Error copying code: %v", err)
+		return
+	}
+	w.status = fmt.Sprintf("Copied code for %s from %s", ent.AccountName, ent.Issuer)
+}
+
+// nextHOTPCode generates the code of the HOTP entry with the ID and saves the
+// advanced counter, so that the code is not handed out again. The database file is
+// read again first and only the counter is changed in it, so that changes other
+// commands made since the dashboard read the database are kept.
+func (w *watcher) nextHOTPCode(id string) (string, error) {
+	fresh, err := w.data.Reload(w.db.path)
+	if err != nil {
+		return "", err
+	}
+	ind, err := fresh.FindEntryByID(id)
+	if err != nil {
+		fresh.Close()
+		return "", err
+	}
+	code, err := fresh.HOTPCode(fresh.Entries[ind])
+	if err != nil {
+		fresh.Close()
+		return "", err
+	}
+	fresh.AdvanceCounter(ind)
+	saved := &dbSession{path: w.db.path, pwd: w.db.pwd, salt: w.db.salt, data: fresh}
+	if err := saved.save(); err != nil {
+		fresh.Close()
+		return "", err
+	}
+
+	// Show the database as written, keeping the query and the selected entry
+	w.data.Close()
+	w.db.data = fresh
+	w.data = fresh
+	w.filter()
+	for i, m := range w.matches {
+		if fresh.Entries[m.Index].ID == id {
+			w.selected = i
+		}
+	}
+	return code, nil
+}
+
+// lock wipes the database key and hides all entries until the database is unlocked again.
+func (w *watcher) lock() {
+	if w.locked {
+		return
+	}
+	w.db.close()
+	w.data = &totpdb.TOTPData{}
+	w.filter()
+	w.locked = true
+	w.password = totpdb.NewSecret(maxPasswordLen)
+	w.typed = 0
+	w.status = ""
+}
+
+// handleLocked collects the password typed while locked and unlocks on Enter.
+func (w *watcher) handleLocked(in []byte) (bool, error) {
+	for _, k := range w.keys(in) {
+		if k.seq != "" {
+			// Arrow keys and other escape sequences are no part of the password
+			continue
+		}
+		switch k.r {
+		case keyCtrlC, keyEscape:
+			return true, nil
+		case keyBackspace, keyDelete:
+			if w.typed > 0 {
+				_, size := utf8.DecodeLastRune(w.password.Bytes()[:w.typed])
+				w.typed -= size
+			}
+		case keyEnter:
+			w.unlock()
+			return false, nil
+		default:
+			if k.r >= ' ' && w.typed+utf8.RuneLen(k.r) <= w.password.Len() {
+				w.typed += utf8.EncodeRune(w.password.Bytes()[w.typed:], k.r)
+			}
+		}
+	}
+	return false, nil
+}
+
+// unlock reads the database again with the typed password.
+func (w *watcher) unlock() {
+	data, err := totpdb.ReadCBORSec(w.db.path, w.password.Bytes()[:w.typed], GetSalt(w.cmd))
+	w.password.Destroy()
+	w.password = totpdb.NewSecret(maxPasswordLen)
+	w.typed = 0
+	if err != nil {
+		w.status = fmt.Sprintf("Error unlocking: %v", err)
+		return
+	}
+
+	w.db.data = data
+	w.data = data
+	w.filter()
+	w.locked = false
+	w.status = ""
+}
+
+// render draws the whole screen.
+func (w *watcher) render(now time.Time) {
+	var sb strings.Builder
+	sb.WriteString("\x1b[H\x1b[J")
+
+	if w.locked {
+		sb.WriteString("Locked after inactivity. Type the password and press Enter to unlock, Esc to quit.\r\n")
+		sb.WriteString(strings.Repeat("*", utf8.RuneCount(w.password.Bytes()[:w.typed])))
+		fmt.Fprintf(&sb, "\r\n\r\n%s", totpdb.CleanCell(w.status))
+		fmt.Fprint(w.out, sb.String())
+		return
+	}
+
+	sb.WriteString("Type to search, Up/Down to select, Enter to copy, Esc to quit\r\n")
+	fmt.Fprintf(&sb, "> %s\r\n", w.query)
+	fmt.Fprintf(&sb, "  %-8s  %-20s  %-24s  %-10s  %s\r\n", "ID", "Issuer", "Account Name", "Code", "Remaining")
+
+	rows := len(w.matches)
+	if _, height, err := term.GetSize(w.fd); err == nil && height > watchHeaderRows {
+		rows = height - watchHeaderRows
+	}
+	first := 0
+	if w.selected >= rows {
+		first = w.selected - rows + 1
+	}
+	last := min(first+rows, len(w.matches))
+
+	for i := first; i < last; i++ {
+		ent := w.data.Entries[w.matches[i].Index]
+		// HOTP codes are only generated on Enter, as every code advances the counter
+		code, remaining := "-", fmt.Sprintf("counter %d", ent.Counter)
+		if ent.Type != totpdb.TypeHOTP {
+			var err error
+			if code, err = w.data.GenerateCode(ent, now); err != nil {
+				code = "error"
+			}
+			remaining = countdown(ent, now)
+		}
+		marker := " "
+		if i == w.selected {
+			marker = "\x1b[7m>"
+		}
+		fmt.Fprintf(&sb, "%s %-8s  %s  %s  %-10s  %s\x1b[0m\r\n",
+			marker, ent.ShortID(), totpdb.FitCell(ent.Issuer, 20), totpdb.FitCell(ent.AccountName, 24), code, remaining)
+	}
+	// The status may hold names, which must not drive the terminal
+	fmt.Fprintf(&sb, "  %d/%d  %s", len(w.matches), len(w.data.Entries), totpdb.CleanCell(w.status))
+	fmt.Fprint(w.out, sb.String())
+}
+
+// countdown draws a bar of the time the current code of the entry stays valid.
+func countdown(ent totpdb.TOTPEntry, now time.Time) string {
+	remaining := ent.Remaining(now)
+	filled := int(int64(watchBarWidth) * int64(remaining) / int64(ent.PeriodDuration()))
+	seconds := int((remaining + time.Second - 1) / time.Second)
+	return fmt.Sprintf("[%s%s] %2ds", strings.Repeat("#", filled), strings.Repeat(".", watchBarWidth-filled), seconds)
+}
+
+func setWatchCommands() {
+	cmdWatch.Flags().Duration(FLAG_LOCK_AFTER, 5*time.Minute, "Lock the dashboard after this time without a key press, 0 for never")
+}
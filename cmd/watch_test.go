@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"bksworm/totpcli/totpdb"
+)
+
+// writeTestDB writes a database with the entries to a temporary file and returns its path.
+func writeTestDB(t *testing.T, password, salt []byte, entries ...totpdb.TOTPEntry) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "entries.db")
+	if err := totpdb.WriteCBORSec(path, &totpdb.TOTPData{Entries: entries}, password, salt); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestWatcherHOTPKeepsConcurrentChanges(t *testing.T) {
+	password, salt := []byte("pw"), []byte("salt")
+	path := writeTestDB(t, password, salt,
+		totpdb.TOTPEntry{Type: totpdb.TypeHOTP, Issuer: "Bank", AccountName: "alice",
+			Secret: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", Digits: 6, Algorithm: "SHA1"},
+		totpdb.TOTPEntry{Type: totpdb.TypeTOTP, Issuer: "ACME", AccountName: "bob",
+			Secret: "JBSWY3DPEHPK3PXP", Digits: 6, Algorithm: "SHA1", Period: 30},
+	)
+	data, err := totpdb.ReadCBORSec(path, password, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &watcher{
+		picker: picker{data: data, out: io.Discard},
+		db:     &dbSession{path: path, pwd: totpdb.NewSecretFrom([]byte("pw")), salt: salt, data: data},
+	}
+	defer func() { w.db.close() }()
+	w.filter()
+	id := data.Entries[0].ID
+
+	// Another command removes bob and adds carol while the dashboard is open
+	other, err := totpdb.ReadCBORSec(path, password, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.RemoveEntry("bob", "ACME"); err != nil {
+		t.Fatal(err)
+	}
+	key, err := totpdb.NewKey(totpdb.TOTPEntry{Type: totpdb.TypeTOTP, Issuer: "ACME", AccountName: "carol",
+		Secret: "JBSWY3DPEHPK3PXP", Digits: 6, Algorithm: "SHA1", Period: 30})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.AddEntry(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := totpdb.WriteCBORSec(path, other, password, salt); err != nil {
+		t.Fatal(err)
+	}
+	other.Close()
+
+	for counter, want := range []string{"755224", "287082"} {
+		code, err := w.nextHOTPCode(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if code != want {
+			t.Errorf("counter %d: got code %s, want %s", counter, code, want)
+		}
+	}
+
+	saved, err := totpdb.ReadCBORSec(path, password, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer saved.Close()
+	if _, err := saved.GetEntry("carol", "ACME"); err != nil {
+		t.Errorf("the added entry was lost: %v", err)
+	}
+	if _, err := saved.GetEntry("bob", "ACME"); err == nil {
+		t.Error("the removed entry came back")
+	}
+	ent, err := saved.GetEntryByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ent.Counter != 2 {
+		t.Errorf("got counter %d, want 2", ent.Counter)
+	}
+	if len(w.data.Entries) != len(saved.Entries) {
+		t.Errorf("the dashboard shows %d entries, the database has %d", len(w.data.Entries), len(saved.Entries))
+	}
+}
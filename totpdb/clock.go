@@ -0,0 +1,20 @@
+package totpdb
+
+import "time"
+
+// Now returns the system time corrected by the clock skew of the database,
+// the time codes are generated and verified for.
+func (data *TOTPData) Now() time.Time {
+	return time.Now().Add(data.ClockSkew)
+}
+
+// Steps returns t followed by the start times of the next n time steps of the entry.
+func (ent TOTPEntry) Steps(t time.Time, n int) []time.Time {
+	steps := []time.Time{t}
+	next := t.Add(ent.Remaining(t))
+	for i := 0; i < n; i++ {
+		steps = append(steps, next)
+		next = next.Add(ent.PeriodDuration())
+	}
+	return steps
+}
@@ -0,0 +1,106 @@
+package totpdb
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/totp"
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported OTP type")
+	// MD5 hashes are too short for the dynamic truncation of RFC 4226.
+	ErrUnsupportedAlgorithm = errors.New("MD5 can not generate codes")
+	ErrMinValidity          = errors.New("minimum validity must be shorter than the period")
+)
+
+const defaultPeriod = 30
+
+// period returns the period of the entry, defaulting to 30 seconds.
+func (ent TOTPEntry) period() uint64 {
+	if ent.Period == 0 {
+		return defaultPeriod
+	}
+	return ent.Period
+}
+
+// PeriodDuration returns the period of the entry as a duration.
+func (ent TOTPEntry) PeriodDuration() time.Duration {
+	return time.Duration(ent.period()) * time.Second
+}
+
+// GenerateCode generates the code of a revealed entry at time t
+// with the digits, period and algorithm of the entry.
+func (ent TOTPEntry) GenerateCode(t time.Time) (string, error) {
+	if ent.Type != TypeTOTP {
+		return "", ErrUnsupportedType
+	}
+	alg, err := ParseAlgorithm(ent.Algorithm)
+	if err != nil {
+		return "", err
+	}
+	if alg == otp.AlgorithmMD5 {
+		return "", ErrUnsupportedAlgorithm
+	}
+	return totp.GenerateCodeCustom(ent.Secret, t, totp.ValidateOpts{
+		Period:    uint(ent.period()),
+		Digits:    otp.Digits(ent.Digits),
+		Algorithm: alg,
+	})
+}
+
+// Remaining returns how long the code generated at time t stays valid.
+func (ent TOTPEntry) Remaining(t time.Time) time.Duration {
+	period := ent.PeriodDuration()
+	return period - time.Duration(t.UnixNano())%period
+}
+
+// FreshAt returns the time from t on at which the code of the entry stays valid for
+// at least minValidity: t itself if enough of the period remains, else the start of the
+// next period. minValidity must be shorter than the period.
+func (ent TOTPEntry) FreshAt(t time.Time, minValidity time.Duration) (time.Time, error) {
+	if minValidity >= ent.PeriodDuration() {
+		return t, fmt.Errorf("%w: %s is not shorter than %s", ErrMinValidity, minValidity, ent.PeriodDuration())
+	}
+	if remaining := ent.Remaining(t); remaining < minValidity {
+		return t.Add(remaining), nil
+	}
+	return t, nil
+}
+
+// GenerateCode generates the code of an entry of the database at time t.
+// Sealed entries are revealed only for the time of the computation.
+func (data *TOTPData) GenerateCode(ent TOTPEntry, t time.Time) (string, error) {
+	ent, err := data.RevealEntry(ent)
+	if err != nil {
+		return "", err
+	}
+	return ent.GenerateCode(t)
+}
+
+// HOTPCode generates the code of an HOTP entry of the database for its counter.
+// The counter must be advanced with AdvanceCounter and the database saved before
+// the code is handed out, so that no code is generated twice.
+func (data *TOTPData) HOTPCode(ent TOTPEntry) (string, error) {
+	if ent.Type != TypeHOTP {
+		return "", ErrUnsupportedType
+	}
+	ent, err := data.RevealEntry(ent)
+	if err != nil {
+		return "", err
+	}
+	return ent.hotpCode(ent.Counter)
+}
+
+// AdvanceCounter moves the HOTP entry at index on to its next counter.
+func (data *TOTPData) AdvanceCounter(index int) {
+	data.Entries[index].Counter++
+}
+
+// MarkUsed records that a code of the entry at index was just used, see SortUsed
+// and RecordUse.
+func (data *TOTPData) MarkUsed(index int) {
+	data.Entries[index].Used = time.Now()
+}
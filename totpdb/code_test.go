@@ -0,0 +1,109 @@
+package totpdb
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestHOTPCode checks the codes against the test values of RFC 4226, appendix D.
+func TestHOTPCode(t *testing.T) {
+	data := &TOTPData{Entries: []TOTPEntry{{
+		Type:      TypeHOTP,
+		Secret:    "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", // "12345678901234567890"
+		Digits:    6,
+		Algorithm: "SHA1",
+	}}}
+	want := []string{"755224", "287082", "359152", "969429", "338314"}
+	for counter, code := range want {
+		got, err := data.HOTPCode(data.Entries[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != code {
+			t.Errorf("counter %d: got %s, want %s", counter, got, code)
+		}
+		data.AdvanceCounter(0)
+	}
+	if data.Entries[0].Counter != uint64(len(want)) {
+		t.Errorf("got counter %d, want %d", data.Entries[0].Counter, len(want))
+	}
+
+	if _, err := data.HOTPCode(TOTPEntry{Type: TypeTOTP}); err != ErrUnsupportedType {
+		t.Errorf("got error %v for a TOTP entry, want %v", err, ErrUnsupportedType)
+	}
+}
+
+func TestRemaining(t *testing.T) {
+	ent := TOTPEntry{Type: TypeTOTP, Period: 30}
+	tests := []struct {
+		at   time.Time
+		want time.Duration
+	}{
+		{time.Unix(60, 0), 30 * time.Second},
+		{time.Unix(59, 0), time.Second},
+		{time.Unix(60, int64(500*time.Millisecond)), 29500 * time.Millisecond},
+		{time.Unix(89, 999999999), time.Nanosecond},
+	}
+	for _, tt := range tests {
+		if got := ent.Remaining(tt.at); got != tt.want {
+			t.Errorf("at %s: got %s, want %s", tt.at.UTC(), got, tt.want)
+		}
+	}
+	// A missing period counts as 30 seconds
+	if got := (TOTPEntry{}).Remaining(time.Unix(50, 0)); got != 10*time.Second {
+		t.Errorf("without period: got %s, want 10s", got)
+	}
+}
+
+func TestSteps(t *testing.T) {
+	ent := TOTPEntry{Type: TypeTOTP, Period: 60}
+	at := time.Unix(90, 0)
+	got := ent.Steps(at, 2)
+	want := []time.Time{at, time.Unix(120, 0), time.Unix(180, 0)}
+	if len(got) != len(want) {
+		t.Fatalf("got %d times, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Errorf("step %d: got %d, want %d", i, got[i].Unix(), want[i].Unix())
+		}
+	}
+	if got := ent.Steps(at, 0); len(got) != 1 || !got[0].Equal(at) {
+		t.Errorf("got %v without next steps, want only %v", got, at)
+	}
+}
+
+func TestFreshAt(t *testing.T) {
+	ent := TOTPEntry{Type: TypeTOTP, Period: 30}
+	tests := []struct {
+		unix, want int64
+		min        time.Duration
+	}{
+		{45, 45, 10 * time.Second},
+		// Exactly the minimum left is enough
+		{50, 50, 10 * time.Second},
+		{55, 60, 10 * time.Second},
+		{59, 59, 0},
+	}
+	for _, tt := range tests {
+		got, err := ent.FreshAt(time.Unix(tt.unix, 0), tt.min)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Unix() != tt.want {
+			t.Errorf("at %d with %s: got %d, want %d", tt.unix, tt.min, got.Unix(), tt.want)
+		}
+	}
+	if _, err := ent.FreshAt(time.Unix(45, 0), 30*time.Second); !errors.Is(err, ErrMinValidity) {
+		t.Errorf("got error %v for the full period, want %v", err, ErrMinValidity)
+	}
+}
+
+func TestGenerateCodeType(t *testing.T) {
+	ent := rfc6238Entries["SHA1"]
+	ent.Type = TypeHOTP
+	if _, err := ent.GenerateCode(time.Unix(59, 0)); !errors.Is(err, ErrUnsupportedType) {
+		t.Errorf("got error %v for an HOTP entry, want %v", err, ErrUnsupportedType)
+	}
+}
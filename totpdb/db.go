@@ -6,80 +6,145 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"time"
 
+	"filippo.io/age"
 	"github.com/fxamacker/cbor/v2"
-	"github.com/olekukonko/tablewriter"
 	"github.com/pquerna/otp"
 )
 
 var (
-	ErrEntryExists   = errors.New("TOTP entry already exists")
-	ErrEntryNotFound = errors.New("TOTP entry not found")
+	ErrEntryExists    = errors.New("TOTP entry already exists")
+	ErrEntryNotFound  = errors.New("TOTP entry not found")
+	ErrAmbiguousEntry = errors.New("ambiguous TOTP entry")
+	ErrInvalidDigits  = errors.New("digits must be between 1 and 10")
+	ErrInvalidPeriod  = errors.New("period must be greater than zero")
 )
 
 const defaultSize = 10
 
+// DataVersion is the version of the TOTPData layout.
+//
+// Version 0 entries store the otpauth URL next to the parameters, see MigrateURLs.
+// Version 1 entries store normalized parameters only and build the URL on demand.
+// Version 2 entries have an ID, see Migrate.
+const DataVersion = 2
+
 // TOTPData represents the structure of the CBOR file.
 type TOTPData struct {
-	Entries []TOTPEntry // map[name]url
+	Version int            `cbor:"version,omitempty"` // DataVersion for migrated databases
+	Entries []TOTPEntry    // map[name]url
+	Trash   []TrashedEntry `cbor:"trash,omitempty"` // removed entries, see RestoreEntry
+	// TrashRetention is how long removed entries stay in the trash,
+	// DefaultTrashRetention if zero and for ever if negative.
+	TrashRetention time.Duration `cbor:"trash_retention,omitempty"`
+	// ClockSkew corrects the system clock when generating codes, see Now.
+	ClockSkew time.Duration `cbor:"clock_skew,omitempty"`
+	// CompletionIndex keeps the unencrypted Index next to the database, see WriteIndex.
+	CompletionIndex bool `cbor:"completion_index,omitempty"`
+
+	keys *keyring // data key and key slots, set for encrypted databases
 }
 
 // TOTPEntry represents a TOTP entry with all the necessary details.
+// The otpauth URL is not stored, it is built from the parameters by URL.
 type TOTPEntry struct {
-	Issuer      string `cbor:"issuer"`
-	AccountName string `cbor:"account_name"`
-	Secret      string `cbor:"secret"`
-	Type        string `cbor:"type"`
-	Period      uint64 `cbor:"period"`
-	Digits      int    `cbor:"digits"`
-	Algorithm   string `cbor:"algorithm"`
-	URL         string `cbor:"url"`
+	ID          string    `cbor:"id,omitempty"` // random UUID
+	Created     time.Time `cbor:"created,omitempty"`
+	Modified    time.Time `cbor:"modified,omitempty"`
+	Used        time.Time `cbor:"used,omitempty"` // last time a code was generated, see MarkUsed
+	Issuer      string    `cbor:"issuer"`
+	AccountName string    `cbor:"account_name"`
+	Secret      string    `cbor:"secret,omitempty"`
+	Type        string    `cbor:"type"`
+	Period      uint64    `cbor:"period"`
+	Digits      int       `cbor:"digits"`
+	Algorithm   string    `cbor:"algorithm"`
+	Counter     uint64    `cbor:"counter,omitempty"` // next counter of HOTP entries
+	LegacyURL   string    `cbor:"url,omitempty"`     // only set in version 0 databases
+	Sealed      []byte    `cbor:"sealed,omitempty"`  // Secret and LegacyURL encrypted with the entry sub-key
+	Tags        []string  `cbor:"tags,omitempty"`    // normalized, sorted and unique, see NormalizeTag
+	Group       string    `cbor:"group,omitempty"`   // slash separated folder path, see NormalizeGroup
+	Notes       string    `cbor:"notes,omitempty"`
+	Favorite    bool      `cbor:"favorite,omitempty"`
+	Icon        string    `cbor:"icon,omitempty"` // name or path of an icon, not interpreted
 }
 
-// ToTOTPEntry converts a Key to a TOTPEntry.
+// ToTOTPEntry converts a Key to a TOTPEntry with normalized parameters.
 func FromOTPKey(k *otp.Key) TOTPEntry {
 	return TOTPEntry{
 		Issuer:      k.Issuer(),
 		AccountName: k.AccountName(),
-		Secret:      k.Secret(),
-		Type:        k.Type(),
+		Secret:      NormalizeSecret(k.Secret()),
+		Type:        strings.ToLower(k.Type()),
 		Period:      k.Period(),
-		Digits:      int(k.Digits()),
+		Digits:      keyDigits(k),
 		Algorithm:   k.Algorithm().String(),
-		URL:         k.URL(),
+		Counter:     keyCounter(k),
 	}
 }
 
 // AddEntry adds a new TOTP entry to TOTPData.
+// The key is validated first, a *ValidationError reports all its issues
+// that are not warnings, see ValidateKey.
 func (data *TOTPData) AddEntry(key *otp.Key) error {
-	ent := FromOTPKey(key)
+	ent, issues := ValidateKey(key)
+	if err := IssuesError(issues); err != nil {
+		return err
+	}
 
 	if data.Entries == nil {
 		data.Entries = make([]TOTPEntry, 0, defaultSize)
 	}
-	// Check if entry already exists
-	_, err := data.FindEntry(ent.AccountName, ent.Issuer)
-
-	if err != nil { // Entry doesn't exist
-		data.Entries = append(data.Entries, ent)
-		return nil
+	if err := data.checkUnique(ent, -1); err != nil {
+		return err
 	}
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	ent.ID = id
+	ent.Created = time.Now()
+	ent.Modified = ent.Created
+	data.Entries = append(data.Entries, ent)
+	return nil
+}
 
-	return ErrEntryExists
+// checkUnique returns ErrEntryExists if an entry other than the one at index except
+// has the account name of ent and its issuer, or any issuer if ent has none.
+// Pass -1 for except to check an entry that is not in the list yet.
+func (data *TOTPData) checkUnique(ent TOTPEntry, except int) error {
+	for ind, other := range data.Entries {
+		if ind != except && other.AccountName == ent.AccountName &&
+			(ent.Issuer == "" || other.Issuer == ent.Issuer) {
+			return ErrEntryExists
+		}
+	}
+	return nil
 }
 
 // FindEntry finds a TOTP entry in TOTPData.
+// If issuer is empty, the account name must be unique, otherwise the
+// returned ErrAmbiguousEntry error lists the candidates.
 func (data *TOTPData) FindEntry(name, issuer string) (int, error) {
+	var found []int
 	for ind, entry := range data.Entries {
 		if entry.AccountName == name {
 			if issuer == "" {
-				return ind, nil
+				found = append(found, ind)
 			} else if entry.Issuer == issuer {
 				return ind, nil
 			}
 		}
 	}
-	return -1, ErrEntryNotFound
+	switch len(found) {
+	case 0:
+		return -1, ErrEntryNotFound
+	case 1:
+		return found[0], nil
+	}
+	return -1, data.ambiguous(name, found)
 }
 
 // GetEntry retrieves a TOTP entry from TOTPData.
@@ -98,45 +163,268 @@ func (data *TOTPData) RemoveEntry(name string, issuer string) error {
 	if err != nil {
 		return err
 	}
+	return data.removeAt(index)
+}
+
+// removeAt moves the entry at index to the trash.
+func (data *TOTPData) removeAt(index int) error {
+	if err := data.trash(data.Entries[index]); err != nil {
+		return err
+	}
 	data.Entries = append(data.Entries[:index], data.Entries[index+1:]...)
 	return nil
 }
 
-// PrintTable prints all entries as a table.
-func (data *TOTPData) PrintTable() {
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Issuer", "Account Name", "Type", "Period", "Digits", "Algorithm"})
+// RemoveEntries moves the entries at the indexes, e.g. those returned by Select,
+// to the trash and returns them in stored order.
+func (data *TOTPData) RemoveEntries(indexes []int) ([]TOTPEntry, error) {
+	remove := make(map[int]bool, len(indexes))
+	for _, ind := range indexes {
+		remove[ind] = true
+	}
+	var removed []TOTPEntry
+	kept := data.Entries[:0]
+	for ind, ent := range data.Entries {
+		if remove[ind] {
+			if err := data.trash(ent); err != nil {
+				return nil, err
+			}
+			removed = append(removed, ent)
+		} else {
+			kept = append(kept, ent)
+		}
+	}
+	data.Entries = kept
+	return removed, nil
+}
+
+// EntryUpdate holds the new values of the fields to change in an entry.
+// Nil fields are left unchanged.
+type EntryUpdate struct {
+	Issuer      *string
+	AccountName *string
+	Secret      *string
+	Digits      *int
+	Period      *uint64
+	Algorithm   *string
+	Group       *string
+	Notes       *string
+	Favorite    *bool
+	Icon        *string
+}
 
-	for _, ent := range data.Entries {
-		table.Append([]string{
-			ent.Issuer,
-			ent.AccountName,
-			ent.Type,
-			fmt.Sprintf("%d", ent.Period),
-			fmt.Sprintf("%d", ent.Digits),
-			ent.Algorithm,
-		})
+// UpdateEntry changes the fields of a TOTP entry in TOTPData.
+// The updated entry is checked by ValidateEntry, and a new account name or issuer
+// must not clash with another entry, just as in AddEntry. The warnings of
+// ValidateEntry are returned.
+func (data *TOTPData) UpdateEntry(name, issuer string, upd EntryUpdate) ([]EntryIssue, error) {
+	index, err := data.FindEntry(name, issuer)
+	if err != nil {
+		return nil, err
 	}
+	return data.UpdateEntryAt(index, upd)
+}
 
-	table.Render()
+// UpdateEntryAt changes the fields of the entry at index, e.g. one returned by
+// FindEntry, see UpdateEntry.
+func (data *TOTPData) UpdateEntryAt(index int, upd EntryUpdate) ([]EntryIssue, error) {
+	ent, err := data.RevealEntry(data.Entries[index])
+	if err != nil {
+		return nil, err
+	}
+
+	if upd.Issuer != nil {
+		ent.Issuer = *upd.Issuer
+	}
+	if upd.AccountName != nil {
+		ent.AccountName = *upd.AccountName
+	}
+	if upd.Secret != nil {
+		ent.Secret = *upd.Secret
+	}
+	if upd.Digits != nil {
+		ent.Digits = *upd.Digits
+	}
+	if upd.Period != nil {
+		ent.Period = *upd.Period
+	}
+	if upd.Algorithm != nil {
+		ent.Algorithm = *upd.Algorithm
+	}
+	if upd.Group != nil {
+		ent.Group = NormalizeGroup(*upd.Group)
+	}
+	if upd.Notes != nil {
+		ent.Notes = *upd.Notes
+	}
+	if upd.Favorite != nil {
+		ent.Favorite = *upd.Favorite
+	}
+	if upd.Icon != nil {
+		ent.Icon = *upd.Icon
+	}
+
+	ent, issues := ValidateEntry(ent)
+	if err := IssuesError(issues); err != nil {
+		return nil, err
+	}
+	// Check if the new name clashes with another entry
+	if err := data.checkUnique(ent, index); err != nil {
+		return nil, err
+	}
+
+	// Keep the URL of version 0 databases in line with the parameters
+	if ent.LegacyURL != "" {
+		ent.LegacyURL = ent.URL()
+	}
+	ent.Modified = time.Now()
+	// Sealed again by the next write
+	data.Entries[index] = ent
+	return issues, nil
+}
+
+// ListOptions selects the entries and the columns of PrintTable.
+type ListOptions struct {
+	Query             // entries to list and their order
+	Codes   bool      // current code and its remaining validity
+	Next    bool      // also the code of the following period
+	Time    time.Time // time the codes are generated for, now if zero
+	Columns []string  // keys of the columns of tables, CSV and TSV, see ColumnKeys
+}
+
+// PrintTable writes the entries selected by opts to w in the given output format.
+// With opts.Codes the secrets are revealed one at a time, only to compute the codes.
+func (data *TOTPData) PrintTable(w io.Writer, format string, opts ListOptions) error {
+	if err := CheckFormat(format); err != nil {
+		return err
+	}
+	now := opts.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	// Selected code columns imply the codes
+	opts.Codes, opts.Next = opts.needsCodes()
+	if _, err := opts.columns(format); err != nil {
+		return err
+	}
+
+	entries, err := data.ListEntries(opts.Query)
+	if err != nil {
+		return err
+	}
+	infos := make([]EntryInfo, 0, len(entries))
+	for _, ent := range entries {
+		info := ent.Info()
+		if opts.Codes {
+			// Entries without codes, e.g. of an unsupported type, are listed without them
+			if withCode, err := data.CodeInfo(ent, now, opts.Next); err == nil {
+				info = withCode
+			}
+		}
+		infos = append(infos, info)
+	}
+	return WriteEntries(w, format, infos, opts)
 }
 
 // ReadCBORSec reads the encrypted CBOR data from the file, decrypts it, and unmarshals it into a TOTPData struct.
-func ReadCBORSec(filename string, password string, salt []byte) (*TOTPData, error) {
+func ReadCBORSec(filename string, password, salt []byte) (*TOTPData, error) {
 	// Read the encrypted data from the file
 	encryptedData, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, err
 	}
 
-	// Derive the encryption key
-	key := DeriveKey([]byte(password), salt, 32)
+	vf, ok, err := decodeVault(encryptedData)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// Legacy database, encrypted directly with the derived key
+		key := DeriveKey(password, salt, 32)
+		defer Wipe(key)
+		return decryptTOTPData(encryptedData, key)
+	}
+
+	// Unwrap the data key with the password
+	key, err := unwrapPassword(vf.Slots, password, salt)
+	if err != nil {
+		return nil, err
+	}
+	return openVault(vf, key)
+}
+
+// ReadCBORSecIdentity reads the encrypted CBOR data from the file and decrypts it
+// with the data key wrapped to one of the age identities.
+func ReadCBORSecIdentity(filename string, identities []age.Identity) (*TOTPData, error) {
+	encryptedData, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	vf, ok, err := decodeVault(encryptedData)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrLegacyDatabase
+	}
+
+	key, err := unwrapIdentities(vf.Slots, identities)
+	if err != nil {
+		return nil, err
+	}
+	return openVault(vf, key)
+}
+
+// Reload reads the database file again with the data key data was opened with,
+// to pick up changes other processes made since, without asking for the password.
+// It fails with ErrKeyChanged if the file was written with another data key since,
+// e.g. after a recipient was removed.
+func (data *TOTPData) Reload(filename string) (*TOTPData, error) {
+	if data.keys == nil || data.keys.dataKey == nil {
+		return nil, ErrDatabaseClosed
+	}
+	encryptedData, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
 
+	vf, ok, err := decodeVault(encryptedData)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrKeyChanged
+	}
+	key := NewSecret(data.keys.dataKey.Len())
+	copy(key.Bytes(), data.keys.dataKey.Bytes())
+	fresh, err := openVault(vf, key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrKeyChanged, err)
+	}
+	return fresh, nil
+}
+
+// openVault decrypts the payload with the data key and keeps the key slots for writing back.
+func openVault(vf *vaultFile, key *Secret) (*TOTPData, error) {
+	totpData, err := decryptTOTPData(vf.Payload, key.Bytes())
+	if err != nil {
+		key.Destroy()
+		return nil, err
+	}
+	totpData.keys = &keyring{dataKey: key, slots: vf.Slots}
+	return totpData, nil
+}
+
+// decryptTOTPData decrypts and unmarshals the CBOR data.
+func decryptTOTPData(encryptedData, key []byte) (*TOTPData, error) {
 	// Decrypt the data
 	data, err := Decrypt(encryptedData, key)
 	if err != nil {
 		return nil, err
 	}
+	defer Wipe(data)
 
 	// Unmarshal the CBOR data
 	var totpData TOTPData
@@ -149,25 +437,67 @@ func ReadCBORSec(filename string, password string, salt []byte) (*TOTPData, erro
 }
 
 // WriteCBORSec marshals the TOTPData struct into CBOR, encrypts it, and writes it to the file.
-func WriteCBORSec(filename string, data *TOTPData, password string, salt []byte) error {
+//
+// The secret and URL of every entry are sealed with a sub-key of the data key
+// first, so that a decrypted database does not hold them in plaintext.
+// The data is encrypted with a random data key that is wrapped by the password
+// and by every age recipient. A nil password keeps the existing password slot,
+// which is what callers that unlocked the database with an identity want.
+// Entries trashed longer than the trash retention ago are purged.
+func WriteCBORSec(filename string, data *TOTPData, password, salt []byte) error {
+	data.PurgeTrash(time.Now())
+	if err := data.assignIDs(); err != nil {
+		return err
+	}
+	// Encrypt the secrets of new entries individually
+	if err := data.sealEntries(); err != nil {
+		return err
+	}
+
 	// Marshal the data into CBOR
 	var buf bytes.Buffer
+	defer func() { Wipe(buf.Bytes()[:buf.Cap()]) }()
 	encoder := cbor.NewEncoder(&buf)
 	if err := encoder.Encode(data); err != nil {
 		return err
 	}
 
-	// Derive the encryption key
-	key := DeriveKey([]byte(password), salt, 32)
+	kr, err := data.keyring()
+	if err != nil {
+		return err
+	}
+	// Wrap the data key with the password derived key
+	if password != nil {
+		if err := kr.setPassword(password, salt); err != nil {
+			return err
+		}
+	}
+	if len(kr.slots) == 0 {
+		return ErrNoKeySlots
+	}
 
 	// Encrypt the data
-	encryptedData, err := Encrypt(buf.Bytes(), key)
+	encryptedData, err := Encrypt(buf.Bytes(), kr.dataKey.Bytes())
 	if err != nil {
 		return err
 	}
 
-	// Write the encrypted data to the file
-	return os.WriteFile(filename, encryptedData, 0644)
+	fileData, err := encodeVault(&vaultFile{Slots: kr.slots, Payload: encryptedData})
+	if err != nil {
+		return err
+	}
+
+	// Write the encrypted data to the file, replacing the old one in one step
+	if err := writeFileAtomic(filename, fileData, 0644); err != nil {
+		return err
+	}
+	// Keep the metadata index for shell completion up to date, if it is enabled.
+	// The database is written already, so an index that can not be written is
+	// only removed, completion offers no names then rather than outdated ones.
+	if !data.CompletionIndex || WriteIndex(filename, data) != nil {
+		os.Remove(IndexPath(filename))
+	}
+	return nil
 }
 
 // ReadCBOR reads the TOTP data from a CBOR file.
@@ -0,0 +1,62 @@
+package totpdb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUpdateEntryValidates(t *testing.T) {
+	str := func(s string) *string { return &s }
+	u64 := func(n uint64) *uint64 { return &n }
+	num := func(n int) *int { return &n }
+
+	tests := []struct {
+		name  string
+		typ   string
+		upd   EntryUpdate
+		err   error
+		warns int
+	}{
+		{"empty account", TypeTOTP, EntryUpdate{AccountName: str(" ")}, ErrEmptyAccount, 0},
+		{"clash", TypeTOTP, EntryUpdate{AccountName: str("bob")}, ErrEntryExists, 0},
+		{"bad secret", TypeTOTP, EntryUpdate{Secret: str("not base32!")}, ErrInvalidSecret, 0},
+		{"digits", TypeTOTP, EntryUpdate{Digits: num(11)}, ErrInvalidDigits, 0},
+		{"md5", TypeTOTP, EntryUpdate{Algorithm: str("md5")}, ErrUnsupportedAlgorithm, 0},
+		{"totp period 0", TypeTOTP, EntryUpdate{Period: u64(0)}, ErrInvalidPeriod, 0},
+		{"hotp period 0", TypeHOTP, EntryUpdate{Period: u64(0)}, nil, 0},
+		{"weak secret", TypeTOTP, EntryUpdate{Secret: str("JBSWY3DP")}, nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &TOTPData{Entries: []TOTPEntry{
+				{Issuer: "ACME", AccountName: "alice", Secret: "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP",
+					Type: tt.typ, Algorithm: "SHA1", Digits: 6, Period: 30},
+				{Issuer: "ACME", AccountName: "bob", Secret: "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP",
+					Type: TypeTOTP, Algorithm: "SHA1", Digits: 6, Period: 30},
+			}}
+			issues, err := data.UpdateEntry("alice", "ACME", tt.upd)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				if !data.Entries[0].Modified.IsZero() {
+					t.Errorf("entry changed by a rejected update: %+v", data.Entries[0])
+				}
+				return
+			}
+			if len(issues) != tt.warns {
+				t.Errorf("got warnings %v, want %d", issues, tt.warns)
+			}
+		})
+	}
+
+	// The algorithm is stored normalized
+	data := &TOTPData{Entries: []TOTPEntry{{AccountName: "alice", Secret: "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP",
+		Type: TypeTOTP, Algorithm: "SHA1", Digits: 6, Period: 30}}}
+	if _, err := data.UpdateEntry("alice", "", EntryUpdate{Algorithm: str("sha256")}); err != nil {
+		t.Fatal(err)
+	}
+	if got := data.Entries[0].Algorithm; got != "SHA256" {
+		t.Errorf("got algorithm %q, want SHA256", got)
+	}
+}
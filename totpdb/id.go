@@ -0,0 +1,109 @@
+package totpdb
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ShortIDLen is the length of the ID prefix shown in tables, see FindEntryByID.
+const ShortIDLen = 8
+
+// newID returns a random (version 4) UUID.
+func newID() (string, error) {
+	var u [16]byte
+	if _, err := io.ReadFull(rand.Reader, u[:]); err != nil {
+		return "", err
+	}
+	u[6] = (u[6] & 0x0f) | 0x40 // version 4
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16]), nil
+}
+
+// ShortID returns the prefix of the entry ID shown in tables.
+func (ent TOTPEntry) ShortID() string {
+	if len(ent.ID) > ShortIDLen {
+		return ent.ID[:ShortIDLen]
+	}
+	return ent.ID
+}
+
+// assignIDs gives an ID to every entry that has none, as entries of older databases.
+func (data *TOTPData) assignIDs() error {
+	for ind := range data.Entries {
+		if data.Entries[ind].ID != "" {
+			continue
+		}
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		data.Entries[ind].ID = id
+	}
+	return nil
+}
+
+// FindEntryByID finds a TOTP entry in TOTPData by its ID or by a unique prefix of it.
+// The ErrAmbiguousEntry error of a prefix of several IDs lists all of them.
+func (data *TOTPData) FindEntryByID(id string) (int, error) {
+	if id == "" {
+		return -1, ErrEntryNotFound
+	}
+	id = strings.ToLower(id)
+	var found []int
+	for ind, entry := range data.Entries {
+		if entry.ID == "" || !strings.HasPrefix(entry.ID, id) {
+			continue
+		}
+		if entry.ID == id {
+			return ind, nil
+		}
+		found = append(found, ind)
+	}
+	switch len(found) {
+	case 0:
+		return -1, ErrEntryNotFound
+	case 1:
+		return found[0], nil
+	}
+	return -1, data.ambiguous(id, found)
+}
+
+// GetEntryByID retrieves a TOTP entry from TOTPData by its ID.
+func (data *TOTPData) GetEntryByID(id string) (TOTPEntry, error) {
+	ind, err := data.FindEntryByID(id)
+	if err != nil {
+		return TOTPEntry{}, err
+	}
+	return data.Entries[ind], nil
+}
+
+// RemoveEntryByID removes a TOTP entry from TOTPData by its ID.
+func (data *TOTPData) RemoveEntryByID(id string) error {
+	index, err := data.FindEntryByID(id)
+	if err != nil {
+		return err
+	}
+	return data.removeAt(index)
+}
+
+// UpdateEntryByID changes the fields of a TOTP entry in TOTPData selected by its ID.
+// It returns the warnings of ValidateEntry, see UpdateEntry.
+func (data *TOTPData) UpdateEntryByID(id string, upd EntryUpdate) ([]EntryIssue, error) {
+	index, err := data.FindEntryByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return data.UpdateEntryAt(index, upd)
+}
+
+// ambiguous returns an ErrAmbiguousEntry error listing the candidate entries.
+func (data *TOTPData) ambiguous(what string, candidates []int) error {
+	names := make([]string, 0, len(candidates))
+	for _, ind := range candidates {
+		ent := data.Entries[ind]
+		names = append(names, fmt.Sprintf("%s from %s (id %s)", ent.AccountName, ent.Issuer, ent.ShortID()))
+	}
+	return fmt.Errorf("%w %q, candidates are: %s", ErrAmbiguousEntry, what, strings.Join(names, ", "))
+}
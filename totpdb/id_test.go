@@ -0,0 +1,48 @@
+package totpdb
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFindEntryByID(t *testing.T) {
+	data := &TOTPData{Entries: []TOTPEntry{
+		{ID: "1f0c2a9e-0000-4000-8000-000000000001", Issuer: "ACME", AccountName: "alice"},
+		{ID: "1f0c2a9e-0000-4000-8000-000000000002", Issuer: "ACME", AccountName: "bob"},
+		{ID: "1f0d0000-0000-4000-8000-000000000003", Issuer: "Bank", AccountName: "carol"},
+		{ID: "2a000000-0000-4000-8000-000000000004", Issuer: "Bank", AccountName: "dave"},
+	}}
+
+	tests := []struct {
+		id   string
+		want int
+		err  error
+	}{
+		{"2a", 3, nil},
+		{"1F0D", 2, nil},
+		{"1f0c2a9e-0000-4000-8000-000000000002", 1, nil},
+		{"3", -1, ErrEntryNotFound},
+		{"", -1, ErrEntryNotFound},
+	}
+	for _, tt := range tests {
+		got, err := data.FindEntryByID(tt.id)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("FindEntryByID(%q) = %d, %v, want %d, %v", tt.id, got, err, tt.want, tt.err)
+		}
+	}
+
+	// All candidates of an ambiguous prefix are listed
+	_, err := data.FindEntryByID("1f0")
+	if !errors.Is(err, ErrAmbiguousEntry) {
+		t.Fatalf("got error %v, want %v", err, ErrAmbiguousEntry)
+	}
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error %q does not list %s", err, name)
+		}
+	}
+	if strings.Contains(err.Error(), "dave") {
+		t.Errorf("error %q lists dave", err)
+	}
+}
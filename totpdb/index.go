@@ -0,0 +1,78 @@
+package totpdb
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+// indexSuffix is appended to the database file name to get the path of its index.
+const indexSuffix = ".index"
+
+// Index is the metadata of the entries kept unencrypted next to the database,
+// so that e.g. shell completion can list accounts without the password.
+// It holds no secrets, but it does reveal which accounts the database holds,
+// so it is only written if TOTPData.CompletionIndex is set. Removed entries are
+// left out.
+type Index struct {
+	Entries []IndexEntry `json:"entries"`
+}
+
+// IndexEntry is the metadata of an entry in the Index.
+type IndexEntry struct {
+	ID          string   `json:"id"`
+	Issuer      string   `json:"issuer"`
+	AccountName string   `json:"account_name"`
+	Tags        []string `json:"tags,omitempty"`
+	Group       string   `json:"group,omitempty"`
+}
+
+func indexEntry(ent TOTPEntry) IndexEntry {
+	return IndexEntry{
+		ID:          ent.ID,
+		Issuer:      ent.Issuer,
+		AccountName: ent.AccountName,
+		Tags:        ent.Tags,
+		Group:       ent.Group,
+	}
+}
+
+// Index returns the metadata of the entries.
+func (data *TOTPData) Index() Index {
+	idx := Index{Entries: make([]IndexEntry, len(data.Entries))}
+	for i, ent := range data.Entries {
+		idx.Entries[i] = indexEntry(ent)
+	}
+	return idx
+}
+
+// IndexPath returns the path of the index of the database file.
+func IndexPath(filename string) string {
+	return filename + indexSuffix
+}
+
+// WriteIndex writes the index of the data next to the database file.
+func WriteIndex(filename string, data *TOTPData) error {
+	b, err := json.Marshal(data.Index())
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(IndexPath(filename), b, 0600)
+}
+
+// ReadIndex reads the index of the database file.
+func ReadIndex(filename string) (Index, error) {
+	var idx Index
+	b, err := os.ReadFile(IndexPath(filename))
+	if err != nil {
+		return idx, err
+	}
+	err = json.Unmarshal(b, &idx)
+	return idx, err
+}
+
+// HasIndex tells whether the database file has an index.
+func HasIndex(filename string) bool {
+	_, err := os.Stat(IndexPath(filename))
+	return !errors.Is(err, os.ErrNotExist)
+}
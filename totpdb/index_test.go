@@ -0,0 +1,74 @@
+package totpdb
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteCBORSecIndex(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "entries.db")
+	password, salt := []byte("pw"), []byte("salt")
+	data := &TOTPData{Entries: []TOTPEntry{
+		{ID: "1f0c2a9e", Issuer: "ACME", AccountName: "alice", Type: TypeTOTP, Secret: "JBSWY3DPEHPK3PXP"},
+		{ID: "2a0c2a9e", Issuer: "Bank", AccountName: "bob", Type: TypeTOTP, Secret: "JBSWY3DPEHPK3PXP"},
+	}}
+	if err := data.RemoveEntryByID("2a"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The index is opt-in
+	if err := WriteCBORSec(filename, data, password, salt); err != nil {
+		t.Fatal(err)
+	}
+	if HasIndex(filename) {
+		t.Fatal("index written without CompletionIndex")
+	}
+
+	data.CompletionIndex = true
+	if err := WriteCBORSec(filename, data, password, salt); err != nil {
+		t.Fatal(err)
+	}
+	idx, err := ReadIndex(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The trash is left out
+	if len(idx.Entries) != 1 || idx.Entries[0].AccountName != "alice" {
+		t.Errorf("got index %+v", idx)
+	}
+	if b, _ := os.ReadFile(IndexPath(filename)); strings.Contains(string(b), "bob") {
+		t.Errorf("index lists the trashed entry: %s", b)
+	}
+
+	// Turning it off removes it
+	data.CompletionIndex = false
+	if err := WriteCBORSec(filename, data, password, salt); err != nil {
+		t.Fatal(err)
+	}
+	if HasIndex(filename) {
+		t.Error("index kept after turning CompletionIndex off")
+	}
+}
+
+func TestWriteCBORSecIndexFailure(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "entries.db")
+	// A directory in the place of the index can not be replaced
+	if err := os.MkdirAll(filepath.Join(IndexPath(filename), "sub"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	password, salt := []byte("pw"), []byte("salt")
+	data := &TOTPData{CompletionIndex: true,
+		Entries: []TOTPEntry{{ID: "1f0c2a9e", Issuer: "ACME", AccountName: "alice", Type: TypeTOTP, Secret: "JBSWY3DPEHPK3PXP"}}}
+	if err := WriteCBORSec(filename, data, password, salt); err != nil {
+		t.Fatalf("failing to write the index failed the write: %v", err)
+	}
+	read, err := ReadCBORSec(filename, password, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Entries) != 1 || read.Entries[0].AccountName != "alice" {
+		t.Errorf("got entries %+v", read.Entries)
+	}
+}
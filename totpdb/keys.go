@@ -0,0 +1,387 @@
+package totpdb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"filippo.io/age"
+	"github.com/fxamacker/cbor/v2"
+)
+
+var (
+	ErrNoKeySlots          = errors.New("database has no key slots")
+	ErrNoPasswordSlot      = errors.New("database has no password slot, unlock it with an identity file")
+	ErrNoMatchingIdentity  = errors.New("no identity matches a recipient of the database")
+	ErrLegacyDatabase      = errors.New("legacy database can only be unlocked with a password")
+	ErrRecipientExists     = errors.New("recipient already exists")
+	ErrRecipientNotFound   = errors.New("recipient not found")
+	ErrLastKeySlot         = errors.New("cannot remove the last key slot of the database")
+	ErrInvalidDatabaseFile = errors.New("invalid database file")
+	ErrDatabaseClosed      = errors.New("database is closed")
+	ErrPasswordRequired    = errors.New("the password is required to rotate the database key")
+	ErrWrongPassword       = errors.New("wrong password")
+	ErrKeyChanged          = errors.New("the database key changed, unlock the database again")
+)
+
+// Key slot kinds.
+const (
+	SlotPassword = "password"
+	SlotAge      = "age"
+)
+
+const dataKeySize = 32
+
+// vaultMagic prefixes databases written with key slots. Files without it are
+// legacy databases encrypted directly with the password derived key.
+var vaultMagic = []byte("TOTPDB\x02\n")
+
+// KeySlot holds a copy of the data key wrapped for one way of unlocking the database.
+type KeySlot struct {
+	Kind      string `cbor:"kind"`
+	Recipient string `cbor:"recipient,omitempty"`
+	// Public is the X25519 public key of recovery slots, see wrapRecovery.
+	Public  []byte `cbor:"public,omitempty"`
+	Wrapped []byte `cbor:"wrapped"`
+}
+
+// vaultFile is the on-disk layout that follows vaultMagic.
+type vaultFile struct {
+	Slots   []KeySlot `cbor:"slots"`
+	Payload []byte    `cbor:"payload"`
+}
+
+// keyring is the data key of an opened database together with its key slots.
+type keyring struct {
+	dataKey *Secret
+	subKey  *Secret // entry sub-key, see entryKey
+	slots   []KeySlot
+}
+
+// newKeyring creates a keyring with a fresh random data key and no slots.
+func newKeyring() (*keyring, error) {
+	key := NewSecret(dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, key.Bytes()); err != nil {
+		key.Destroy()
+		return nil, err
+	}
+	return &keyring{dataKey: key}, nil
+}
+
+// findSlot returns the index of the slot of the given kind and recipient or -1.
+func (kr *keyring) findSlot(kind, recipient string) int {
+	for ind, slot := range kr.slots {
+		if slot.Kind == kind && slot.Recipient == recipient {
+			return ind
+		}
+	}
+	return -1
+}
+
+// setSlot replaces the slot of the same kind and recipient or appends a new one.
+func (kr *keyring) setSlot(slot KeySlot) {
+	if ind := kr.findSlot(slot.Kind, slot.Recipient); ind >= 0 {
+		kr.slots[ind] = slot
+		return
+	}
+	kr.slots = append(kr.slots, slot)
+}
+
+// setPassword wraps the data key with the password derived key.
+func (kr *keyring) setPassword(password, salt []byte) error {
+	kek := DeriveKey(password, salt, 32)
+	defer Wipe(kek)
+
+	wrapped, err := Encrypt(kr.dataKey.Bytes(), kek)
+	if err != nil {
+		return err
+	}
+	kr.setSlot(KeySlot{Kind: SlotPassword, Wrapped: wrapped})
+	return nil
+}
+
+// addRecipient wraps the data key to an age X25519 recipient.
+func (kr *keyring) addRecipient(recipient string) error {
+	r, err := age.ParseX25519Recipient(recipient)
+	if err != nil {
+		return err
+	}
+	// Use the canonical form so that lookups are not case sensitive
+	recipient = r.String()
+	if kr.findSlot(SlotAge, recipient) >= 0 {
+		return ErrRecipientExists
+	}
+
+	wrapped, err := wrapAge(kr.dataKey.Bytes(), r)
+	if err != nil {
+		return err
+	}
+	kr.slots = append(kr.slots, KeySlot{Kind: SlotAge, Recipient: recipient, Wrapped: wrapped})
+	return nil
+}
+
+// wrapAge encrypts the data key to an age recipient.
+func wrapAge(dataKey []byte, r age.Recipient) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := age.Encrypt(&buf, r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(dataKey); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// removeRecipient drops the slot of an age recipient.
+func (kr *keyring) removeRecipient(recipient string) error {
+	if r, err := age.ParseX25519Recipient(recipient); err == nil {
+		recipient = r.String()
+	}
+	ind := kr.findSlot(SlotAge, recipient)
+	if ind < 0 {
+		return ErrRecipientNotFound
+	}
+	if len(kr.slots) == 1 {
+		return ErrLastKeySlot
+	}
+	kr.slots = append(kr.slots[:ind], kr.slots[ind+1:]...)
+	return nil
+}
+
+// rotate replaces the data key with a fresh random one and wraps it again for every
+// slot. The password slot needs the password, which is checked against the slot.
+// Entries sealed with the old key must be revealed before and sealed again after.
+func (kr *keyring) rotate(password, salt []byte) error {
+	fresh, err := newKeyring()
+	if err != nil {
+		return err
+	}
+	newKey := fresh.dataKey
+	for _, slot := range kr.slots {
+		switch slot.Kind {
+		case SlotPassword:
+			if password == nil {
+				newKey.Destroy()
+				return ErrPasswordRequired
+			}
+			old, err := unwrapPassword([]KeySlot{slot}, password, salt)
+			if err != nil {
+				newKey.Destroy()
+				return ErrWrongPassword
+			}
+			old.Destroy()
+			if err := fresh.setPassword(password, salt); err != nil {
+				newKey.Destroy()
+				return err
+			}
+		case SlotAge:
+			r, err := age.ParseX25519Recipient(slot.Recipient)
+			if err == nil {
+				slot.Wrapped, err = wrapAge(newKey.Bytes(), r)
+			}
+			if err != nil {
+				newKey.Destroy()
+				return fmt.Errorf("error wrapping key to %s: %w", slot.Recipient, err)
+			}
+			fresh.slots = append(fresh.slots, slot)
+		case SlotRecovery:
+			if slot.Wrapped, err = wrapRecovery(newKey.Bytes(), slot.Public); err != nil {
+				newKey.Destroy()
+				return err
+			}
+			fresh.slots = append(fresh.slots, slot)
+		default:
+			newKey.Destroy()
+			return fmt.Errorf("%w: unknown key slot %q", ErrInvalidDatabaseFile, slot.Kind)
+		}
+	}
+	if len(fresh.slots) == 0 {
+		newKey.Destroy()
+		return ErrNoKeySlots
+	}
+
+	kr.dataKey.Destroy()
+	kr.subKey.Destroy()
+	kr.dataKey, kr.subKey, kr.slots = newKey, nil, fresh.slots
+	return nil
+}
+
+// unwrapPassword recovers the data key from the password slot.
+func unwrapPassword(slots []KeySlot, password, salt []byte) (*Secret, error) {
+	for _, slot := range slots {
+		if slot.Kind == SlotPassword {
+			kek := DeriveKey(password, salt, 32)
+			defer Wipe(kek)
+
+			key, err := Decrypt(slot.Wrapped, kek)
+			if err != nil {
+				return nil, err
+			}
+			return NewSecretFrom(key), nil
+		}
+	}
+	return nil, ErrNoPasswordSlot
+}
+
+// unwrapIdentities recovers the data key from the first age slot one of the identities can open.
+func unwrapIdentities(slots []KeySlot, identities []age.Identity) (*Secret, error) {
+	for _, slot := range slots {
+		if slot.Kind != SlotAge {
+			continue
+		}
+		r, err := age.Decrypt(bytes.NewReader(slot.Wrapped), identities...)
+		if err != nil {
+			continue
+		}
+		key, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		return NewSecretFrom(key), nil
+	}
+	return nil, ErrNoMatchingIdentity
+}
+
+// LoadIdentities reads age identities from a local identity file, as written by age-keygen.
+func LoadIdentities(filename string) ([]age.Identity, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return age.ParseIdentities(file)
+}
+
+// decodeVault splits a database file with key slots into its slots and encrypted payload.
+// It reports false if the file is a legacy database.
+func decodeVault(raw []byte) (*vaultFile, bool, error) {
+	if !bytes.HasPrefix(raw, vaultMagic) {
+		return nil, false, nil
+	}
+	var vf vaultFile
+	if err := cbor.Unmarshal(raw[len(vaultMagic):], &vf); err != nil {
+		return nil, true, fmt.Errorf("%w: %w", ErrInvalidDatabaseFile, err)
+	}
+	return &vf, true, nil
+}
+
+// encodeVault serializes the slots and encrypted payload into a database file.
+func encodeVault(vf *vaultFile) ([]byte, error) {
+	body, err := cbor.Marshal(vf)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, vaultMagic...), body...), nil
+}
+
+// Recipients returns the age recipients the data key is wrapped to.
+func (data *TOTPData) Recipients() []string {
+	var res []string
+	if data.keys == nil {
+		return res
+	}
+	for _, slot := range data.keys.slots {
+		if slot.Kind == SlotAge {
+			res = append(res, slot.Recipient)
+		}
+	}
+	return res
+}
+
+// AddRecipient wraps the data key to an age X25519 recipient, so that the
+// holder of the matching identity can unlock the database.
+func (data *TOTPData) AddRecipient(recipient string) error {
+	kr, err := data.keyring()
+	if err != nil {
+		return err
+	}
+	return kr.addRecipient(recipient)
+}
+
+// HasPassword reports whether the database can be unlocked with a password.
+func (data *TOTPData) HasPassword() bool {
+	return data.keys == nil || data.keys.findSlot(SlotPassword, "") >= 0
+}
+
+// RemoveRecipients removes the key slots of age X25519 recipients and revokes them
+// with RotateKey, so that a removed recipient can not read later versions of the
+// database even with an old copy of its slot.
+func (data *TOTPData) RemoveRecipients(recipients []string, password, salt []byte) error {
+	if data.keys == nil {
+		return ErrRecipientNotFound
+	}
+	slots := append([]KeySlot{}, data.keys.slots...)
+	for _, r := range recipients {
+		if err := data.keys.removeRecipient(r); err != nil {
+			data.keys.slots = slots
+			return fmt.Errorf("%s: %w", r, err)
+		}
+	}
+	if err := data.RotateKey(password, salt); err != nil {
+		data.keys.slots = slots
+		return err
+	}
+	return nil
+}
+
+// RotateKey replaces the data key, wraps the new one for every key slot and seals
+// all entries with it, see keyring.rotate. The password is needed if the database has
+// a password slot.
+func (data *TOTPData) RotateKey(password, salt []byte) error {
+	kr, err := data.keyring()
+	if err != nil {
+		return err
+	}
+	// Reveal everything with the old key before it is replaced
+	entries := make([]TOTPEntry, len(data.Entries))
+	for i, ent := range data.Entries {
+		if entries[i], err = data.RevealEntry(ent); err != nil {
+			return err
+		}
+	}
+	trash := make([]TrashedEntry, len(data.Trash))
+	for i, t := range data.Trash {
+		trash[i] = t
+		if trash[i].Entry, err = data.RevealEntry(t.Entry); err != nil {
+			return err
+		}
+	}
+
+	if err := kr.rotate(password, salt); err != nil {
+		return err
+	}
+	data.Entries, data.Trash = entries, trash
+	return data.sealEntries()
+}
+
+// Close wipes the data key of the database. The data can not be written
+// and sealed entries can not be revealed after Close.
+func (data *TOTPData) Close() {
+	if data.keys != nil {
+		data.keys.dataKey.Destroy()
+		data.keys.subKey.Destroy()
+	}
+}
+
+// keyring returns the keyring of the database, creating one for new and legacy databases.
+func (data *TOTPData) keyring() (*keyring, error) {
+	if data.keys == nil {
+		kr, err := newKeyring()
+		if err != nil {
+			return nil, err
+		}
+		data.keys = kr
+	}
+	if data.keys.dataKey.Len() == 0 {
+		return nil, ErrDatabaseClosed
+	}
+	return data.keys, nil
+}
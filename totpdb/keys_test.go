@@ -0,0 +1,194 @@
+package totpdb
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func newIdentity(t *testing.T) *age.X25519Identity {
+	t.Helper()
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// revealSecret opens the database with the identity and returns the secret of its first entry.
+func revealSecret(t *testing.T, filename string, id age.Identity) string {
+	t.Helper()
+	data, err := ReadCBORSecIdentity(filename, []age.Identity{id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ent, err := data.RevealEntry(data.Entries[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ent.Secret
+}
+
+func TestIdentityUnlock(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "entries.db")
+	password, salt := []byte("pw"), []byte("salt")
+	alice := newIdentity(t)
+
+	data := &TOTPData{Entries: []TOTPEntry{{Issuer: "ACME", AccountName: "alice", Type: TypeTOTP, Secret: sealSecret}}}
+	if err := data.AddRecipient(alice.Recipient().String()); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteCBORSec(filename, data, password, salt); err != nil {
+		t.Fatal(err)
+	}
+
+	// The identity file as written by age-keygen
+	idFile := filepath.Join(dir, "identity.txt")
+	if err := os.WriteFile(idFile, []byte("# created: now\n"+alice.String()+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := LoadIdentities(idFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := revealSecret(t, filename, ids[0]); got != sealSecret {
+		t.Errorf("got secret %q", got)
+	}
+
+	// A write with a nil password, as after an identity unlock, keeps the password slot
+	read, err := ReadCBORSecIdentity(filename, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteCBORSec(filename, read, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadCBORSec(filename, password, salt); err != nil {
+		t.Errorf("password no longer unlocks: %v", err)
+	}
+
+	if _, err := ReadCBORSecIdentity(filename, []age.Identity{newIdentity(t)}); !errors.Is(err, ErrNoMatchingIdentity) {
+		t.Errorf("got error %v for another identity, want %v", err, ErrNoMatchingIdentity)
+	}
+}
+
+func TestAddRecipient(t *testing.T) {
+	alice := newIdentity(t).Recipient().String()
+	data := &TOTPData{}
+	if err := data.AddRecipient(alice); err != nil {
+		t.Fatal(err)
+	}
+	if err := data.AddRecipient(alice); !errors.Is(err, ErrRecipientExists) {
+		t.Errorf("got error %v adding a recipient twice, want %v", err, ErrRecipientExists)
+	}
+	if err := data.AddRecipient("age1notarecipient"); err == nil {
+		t.Error("invalid recipient accepted")
+	}
+	if got := data.Recipients(); !slices.Equal(got, []string{alice}) {
+		t.Errorf("got recipients %q, want %q", got, alice)
+	}
+}
+
+func TestRemoveRecipientRevokes(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "entries.db")
+	password, salt := []byte("pw"), []byte("salt")
+	alice, bob := newIdentity(t), newIdentity(t)
+
+	data := &TOTPData{Entries: []TOTPEntry{{Issuer: "ACME", AccountName: "alice", Type: TypeTOTP, Secret: sealSecret}}}
+	for _, id := range []*age.X25519Identity{alice, bob} {
+		if err := data.AddRecipient(id.Recipient().String()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := WriteCBORSec(filename, data, password, salt); err != nil {
+		t.Fatal(err)
+	}
+	if got := revealSecret(t, filename, bob); got != sealSecret {
+		t.Fatalf("got secret %q", got)
+	}
+	// Bob keeps a copy of the database, and with it of his slot
+	old, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Failures leave the slots as they were
+	if err := data.RemoveRecipients([]string{bob.Recipient().String()}, nil, nil); !errors.Is(err, ErrPasswordRequired) {
+		t.Errorf("got error %v without the password, want %v", err, ErrPasswordRequired)
+	}
+	if err := data.RemoveRecipients([]string{bob.Recipient().String()}, []byte("wrong"), salt); !errors.Is(err, ErrWrongPassword) {
+		t.Errorf("got error %v with a wrong password, want %v", err, ErrWrongPassword)
+	}
+	if err := data.RemoveRecipients([]string{newIdentity(t).Recipient().String()}, password, salt); !errors.Is(err, ErrRecipientNotFound) {
+		t.Errorf("got error %v for an unknown recipient, want %v", err, ErrRecipientNotFound)
+	}
+	if got := data.Recipients(); len(got) != 2 {
+		t.Fatalf("got recipients %q after failures, want both", got)
+	}
+
+	if err := data.RemoveRecipients([]string{bob.Recipient().String()}, password, salt); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteCBORSec(filename, data, password, salt); err != nil {
+		t.Fatal(err)
+	}
+	if got := data.Recipients(); !slices.Equal(got, []string{alice.Recipient().String()}) {
+		t.Errorf("got recipients %q, want only alice", got)
+	}
+
+	// Bob can open neither the new file nor, with the key of his old slot, its payload
+	if _, err := ReadCBORSecIdentity(filename, []age.Identity{bob}); !errors.Is(err, ErrNoMatchingIdentity) {
+		t.Errorf("got error %v for the removed recipient, want %v", err, ErrNoMatchingIdentity)
+	}
+	oldVault, _, err := decodeVault(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldKey, err := unwrapIdentities(oldVault.Slots, []age.Identity{bob})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vault, _, err := decodeVault(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Decrypt(vault.Payload, oldKey.Bytes()); err == nil {
+		t.Error("the old data key still decrypts the database")
+	}
+
+	// The remaining keys still work
+	if got := revealSecret(t, filename, alice); got != sealSecret {
+		t.Errorf("got secret %q for alice", got)
+	}
+	if _, err := ReadCBORSec(filename, password, salt); err != nil {
+		t.Errorf("password no longer unlocks: %v", err)
+	}
+}
+
+func TestRemoveLastKeySlot(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "entries.db")
+	alice := newIdentity(t).Recipient().String()
+	data := &TOTPData{Entries: []TOTPEntry{{AccountName: "alice", Type: TypeTOTP, Secret: sealSecret}}}
+	if err := data.AddRecipient(alice); err != nil {
+		t.Fatal(err)
+	}
+	// A database without a password slot
+	if err := WriteCBORSec(filename, data, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if data.HasPassword() {
+		t.Error("database without a password slot reports one")
+	}
+	if err := data.RemoveRecipients([]string{alice}, nil, nil); !errors.Is(err, ErrLastKeySlot) {
+		t.Errorf("got error %v removing the last slot, want %v", err, ErrLastKeySlot)
+	}
+}
@@ -0,0 +1,113 @@
+package totpdb
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pquerna/otp"
+)
+
+// URLIssue describes a stored otpauth URL that disagrees with the parameters of its entry.
+type URLIssue struct {
+	Issuer      string `json:"issuer" yaml:"issuer"`
+	AccountName string `json:"account_name" yaml:"account_name"`
+	Field       string `json:"field" yaml:"field"`
+	Detail      string `json:"detail" yaml:"detail"`
+}
+
+func (iss URLIssue) String() string {
+	return fmt.Sprintf("%s from %s: %s %s", iss.AccountName, iss.Issuer, iss.Field, iss.Detail)
+}
+
+// NeedsMigration reports whether the database layout is older than DataVersion.
+func (data *TOTPData) NeedsMigration() bool {
+	return data.Version < DataVersion
+}
+
+// Migrate upgrades the database layout to DataVersion, see MigrateURLs.
+func (data *TOTPData) Migrate() ([]URLIssue, error) {
+	var issues []URLIssue
+	if data.Version < 1 {
+		var err error
+		if issues, err = data.MigrateURLs(); err != nil {
+			return nil, err
+		}
+	}
+	if err := data.assignIDs(); err != nil {
+		return nil, err
+	}
+	data.Version = DataVersion
+	return issues, nil
+}
+
+// MigrateURLs drops the otpauth URLs stored by version 0 databases, in the
+// entries as well as in the trash.
+//
+// Every stored URL is checked against the parameters of its entry, which are
+// the ones used to generate codes and are kept. The returned issues list all
+// inconsistencies; secret values are never included in them.
+func (data *TOTPData) MigrateURLs() ([]URLIssue, error) {
+	var issues []URLIssue
+	for ind := range data.Entries {
+		found, err := data.migrateURL(&data.Entries[ind])
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, found...)
+	}
+	for ind := range data.Trash {
+		found, err := data.migrateURL(&data.Trash[ind].Entry)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, found...)
+	}
+	return issues, nil
+}
+
+// migrateURL drops the stored URL of the entry, leaving it revealed.
+func (data *TOTPData) migrateURL(sealed *TOTPEntry) ([]URLIssue, error) {
+	ent, err := data.RevealEntry(*sealed)
+	if err != nil {
+		return nil, fmt.Errorf("%s from %s: %w", sealed.AccountName, sealed.Issuer, err)
+	}
+	var issues []URLIssue
+	if ent.LegacyURL != "" {
+		issues = checkURL(ent)
+	}
+	ent.LegacyURL = ""
+	ent.Secret = NormalizeSecret(ent.Secret)
+	ent.Type = strings.ToLower(ent.Type)
+	// Sealed again by the next write
+	*sealed = ent
+	return issues, nil
+}
+
+// checkURL compares the stored URL of a revealed entry with its parameters.
+func checkURL(ent TOTPEntry) []URLIssue {
+	issue := func(field, detail string) URLIssue {
+		return URLIssue{Issuer: ent.Issuer, AccountName: ent.AccountName, Field: field, Detail: detail}
+	}
+
+	key, err := otp.NewKeyFromURL(ent.LegacyURL)
+	if err != nil {
+		return []URLIssue{issue("url", "can not be parsed: "+err.Error())}
+	}
+
+	var issues []URLIssue
+	differs := func(field, inEntry, inURL string) {
+		if inEntry != inURL {
+			issues = append(issues, issue(field, fmt.Sprintf("is %q in the entry but %q in the URL", inEntry, inURL)))
+		}
+	}
+	differs("issuer", ent.Issuer, key.Issuer())
+	differs("account name", ent.AccountName, key.AccountName())
+	differs("type", strings.ToLower(ent.Type), strings.ToLower(key.Type()))
+	differs("period", fmt.Sprint(ent.Period), fmt.Sprint(key.Period()))
+	differs("digits", fmt.Sprint(ent.Digits), key.Digits().String())
+	differs("algorithm", ent.Algorithm, key.Algorithm().String())
+	if NormalizeSecret(ent.Secret) != NormalizeSecret(key.Secret()) {
+		issues = append(issues, issue("secret", "differs between the entry and the URL"))
+	}
+	return issues
+}
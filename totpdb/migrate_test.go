@@ -0,0 +1,56 @@
+package totpdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMigrateLegacyEntries(t *testing.T) {
+	const secret = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+	legacy := func(issuer, account, url string) TOTPEntry {
+		return TOTPEntry{Issuer: issuer, AccountName: account, Secret: "jbsw y3dp ehpk 3pxp jbsw y3dp ehpk 3pxp",
+			Type: "TOTP", Algorithm: "SHA1", Digits: 6, Period: 30, LegacyURL: url}
+	}
+	data := &TOTPData{
+		Entries: []TOTPEntry{
+			legacy("ACME", "alice", "otpauth://totp/ACME:alice?secret="+secret+"&issuer=ACME"),
+			legacy("ACME", "bob", "otpauth://totp/Other:bob?secret="+secret+"&issuer=Other"),
+		},
+		Trash: []TrashedEntry{
+			{Entry: legacy("Bank", "carol", "otpauth://totp/Bank:carol?secret="+secret+"&issuer=Bank&digits=8"), Deleted: time.Now()},
+		},
+	}
+	if !data.NeedsMigration() {
+		t.Fatal("version 0 database does not need migration")
+	}
+
+	issues, err := data.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"bob": "issuer", "carol": "digits"}
+	if len(issues) != len(want) {
+		t.Fatalf("got issues %v, want one for each of %v", issues, want)
+	}
+	for _, iss := range issues {
+		if want[iss.AccountName] != iss.Field {
+			t.Errorf("unexpected issue %v", iss)
+		}
+	}
+
+	all := append([]TOTPEntry{}, data.Entries...)
+	for _, tr := range data.Trash {
+		all = append(all, tr.Entry)
+	}
+	for _, ent := range all {
+		if ent.LegacyURL != "" {
+			t.Errorf("%s still has the URL %q", ent.AccountName, ent.LegacyURL)
+		}
+		if ent.Secret != secret || ent.Type != TypeTOTP {
+			t.Errorf("%s not normalized: secret %q, type %q", ent.AccountName, ent.Secret, ent.Type)
+		}
+	}
+	if data.Version != DataVersion || data.NeedsMigration() {
+		t.Errorf("got version %d, want %d", data.Version, DataVersion)
+	}
+}
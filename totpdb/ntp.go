@@ -0,0 +1,99 @@
+package totpdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// DefaultNTPServer is the server CheckClock queries unless another one is given.
+const DefaultNTPServer = "pool.ntp.org"
+
+const (
+	ntpPort       = "123"
+	ntpPacketSize = 48
+	// ntpEpochOffset is the number of seconds from the NTP epoch 1900 to the Unix epoch.
+	ntpEpochOffset = 2208988800
+)
+
+var ErrInvalidNTPResponse = errors.New("invalid NTP response")
+
+// ClockCheck is the offset of the system clock to an NTP server found by CheckClock.
+type ClockCheck struct {
+	Server string
+	// Offset is the correction to add to the system time to get the time of the server,
+	// positive if the system clock is behind. It can be stored as TOTPData.ClockSkew.
+	Offset    time.Duration
+	RoundTrip time.Duration
+}
+
+// CheckClock queries the NTP server with a single SNTP request (RFC 4330) and returns
+// the offset of the system clock. The port defaults to 123.
+func CheckClock(server string, timeout time.Duration) (ClockCheck, error) {
+	if server == "" {
+		server = DefaultNTPServer
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, ntpPort)
+	}
+	check := ClockCheck{Server: server}
+
+	conn, err := net.DialTimeout("udp", server, timeout)
+	if err != nil {
+		return check, err
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return check, err
+	}
+
+	req := make([]byte, ntpPacketSize)
+	req[0] = 4<<3 | 3 // version 4, client mode
+	sent := time.Now()
+	putNTPTime(req[40:], sent)
+	if _, err := conn.Write(req); err != nil {
+		return check, err
+	}
+
+	resp := make([]byte, ntpPacketSize)
+	n, err := conn.Read(resp)
+	received := time.Now()
+	if err != nil {
+		return check, err
+	}
+	if n < ntpPacketSize {
+		return check, fmt.Errorf("%w: %d bytes", ErrInvalidNTPResponse, n)
+	}
+	switch {
+	case resp[0]&7 != 4:
+		return check, fmt.Errorf("%w: mode %d", ErrInvalidNTPResponse, resp[0]&7)
+	case resp[1] == 0:
+		return check, fmt.Errorf("%w: server refused with code %q", ErrInvalidNTPResponse, resp[12:16])
+	case string(resp[24:32]) != string(req[40:48]):
+		return check, fmt.Errorf("%w: not an answer to the request", ErrInvalidNTPResponse)
+	}
+
+	// Offset and round trip from the client and server timestamps, see RFC 4330 section 5
+	serverReceived := ntpTime(resp[32:])
+	serverSent := ntpTime(resp[40:])
+	check.Offset = (serverReceived.Sub(sent) + serverSent.Sub(received)) / 2
+	check.RoundTrip = received.Sub(sent) - serverSent.Sub(serverReceived)
+	return check, nil
+}
+
+// putNTPTime writes t as a 64 bit NTP timestamp.
+func putNTPTime(b []byte, t time.Time) {
+	sec := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	binary.BigEndian.PutUint64(b, sec<<32|frac)
+}
+
+// ntpTime reads a 64 bit NTP timestamp.
+func ntpTime(b []byte) time.Time {
+	ts := binary.BigEndian.Uint64(b)
+	sec := int64(ts>>32) - ntpEpochOffset
+	nsec := int64((ts & 0xffffffff) * uint64(time.Second) >> 32)
+	return time.Unix(sec, nsec)
+}
@@ -0,0 +1,109 @@
+package totpdb
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveNTP answers the first request to a local UDP socket with the packet built by
+// reply, sending nothing if it returns nil, and returns the address of the socket.
+func serveNTP(t *testing.T, reply func(req []byte) []byte) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		req := make([]byte, ntpPacketSize)
+		n, addr, err := conn.ReadFrom(req)
+		if err != nil {
+			return
+		}
+		if resp := reply(req[:n]); resp != nil {
+			conn.WriteTo(resp, addr)
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// ntpReply builds a server reply to req with the clock of the server ahead by skew.
+func ntpReply(req []byte, skew time.Duration) []byte {
+	resp := make([]byte, ntpPacketSize)
+	resp[0] = 4<<3 | 4 // version 4, server mode
+	resp[1] = 2        // stratum
+	copy(resp[24:32], req[40:48])
+	now := time.Now().Add(skew)
+	putNTPTime(resp[32:], now)
+	putNTPTime(resp[40:], now)
+	return resp
+}
+
+func TestCheckClockOffset(t *testing.T) {
+	for _, skew := range []time.Duration{0, 7500 * time.Millisecond, -3 * time.Minute} {
+		addr := serveNTP(t, func(req []byte) []byte { return ntpReply(req, skew) })
+		check, err := CheckClock(addr, time.Second)
+		if err != nil {
+			t.Fatalf("skew %s: %v", skew, err)
+		}
+		if diff := (check.Offset - skew).Abs(); diff > 50*time.Millisecond {
+			t.Errorf("skew %s: got offset %s", skew, check.Offset)
+		}
+		if check.RoundTrip < 0 || check.RoundTrip > time.Second {
+			t.Errorf("skew %s: got round trip %s", skew, check.RoundTrip)
+		}
+		if check.Server != addr {
+			t.Errorf("got server %q, want %q", check.Server, addr)
+		}
+	}
+}
+
+func TestCheckClockInvalidReplies(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(resp []byte) []byte
+		want   string
+	}{
+		{"client mode", func(resp []byte) []byte { resp[0] = 4<<3 | 3; return resp }, "mode 3"},
+		{"wrong originate", func(resp []byte) []byte { resp[24]++; return resp }, "not an answer"},
+		{"kiss of death", func(resp []byte) []byte { resp[1] = 0; copy(resp[12:16], "RATE"); return resp }, `"RATE"`},
+		{"short", func(resp []byte) []byte { return resp[:20] }, "20 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			addr := serveNTP(t, func(req []byte) []byte { return tt.modify(ntpReply(req, 0)) })
+			_, err := CheckClock(addr, time.Second)
+			if !errors.Is(err, ErrInvalidNTPResponse) {
+				t.Fatalf("got error %v, want %v", err, ErrInvalidNTPResponse)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error %q does not mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckClockTimeout(t *testing.T) {
+	addr := serveNTP(t, func(req []byte) []byte { return nil })
+	start := time.Now()
+	_, err := CheckClock(addr, 200*time.Millisecond)
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("got error %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("timed out after %s", elapsed)
+	}
+}
+
+func TestNTPTimeRoundTrip(t *testing.T) {
+	want := time.Date(2024, 5, 1, 12, 0, 0, 123456789, time.UTC)
+	b := make([]byte, 8)
+	putNTPTime(b, want)
+	if got := ntpTime(b); (got.Sub(want)).Abs() > time.Microsecond {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
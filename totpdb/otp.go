@@ -1 +1,124 @@
 package totpdb
+
+import (
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pquerna/otp"
+)
+
+var (
+	ErrInvalidSecret    = errors.New("secret is not valid base32")
+	ErrUnknownAlgorithm = errors.New("unknown algorithm")
+	ErrUnknownType      = errors.New("OTP type must be totp or hotp")
+)
+
+// OTP types.
+const (
+	TypeTOTP = "totp"
+	TypeHOTP = "hotp"
+)
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// ParseAlgorithm returns the otp.Algorithm with the given name, ignoring case.
+func ParseAlgorithm(name string) (otp.Algorithm, error) {
+	switch strings.ToUpper(name) {
+	case "SHA1":
+		return otp.AlgorithmSHA1, nil
+	case "SHA256":
+		return otp.AlgorithmSHA256, nil
+	case "SHA512":
+		return otp.AlgorithmSHA512, nil
+	case "MD5":
+		return otp.AlgorithmMD5, nil
+	}
+	return 0, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, name)
+}
+
+// DecodeSecret decodes a base32 secret, tolerating spaces, lower case and missing padding.
+func DecodeSecret(secret string) ([]byte, error) {
+	key, err := secretEncoding.DecodeString(NormalizeSecret(secret))
+	if err != nil || len(key) == 0 {
+		return nil, ErrInvalidSecret
+	}
+	return key, nil
+}
+
+// NormalizeSecret returns the base32 secret in upper case without spaces and padding.
+func NormalizeSecret(secret string) string {
+	secret = strings.ToUpper(secret)
+	secret = strings.NewReplacer(" ", "", "\t", "", "-", "").Replace(secret)
+	return strings.TrimRight(secret, "=")
+}
+
+// URL builds the canonical otpauth URL of the entry from its parameters.
+// The entry must be revealed, otherwise the URL has no secret.
+func (ent TOTPEntry) URL() string {
+	v := url.Values{}
+	v.Set("secret", ent.Secret)
+	if ent.Issuer != "" {
+		v.Set("issuer", ent.Issuer)
+	}
+	v.Set("algorithm", ent.Algorithm)
+	v.Set("digits", strconv.Itoa(ent.Digits))
+	v.Set("period", strconv.FormatUint(ent.Period, 10))
+	if ent.Type == TypeHOTP {
+		v.Set("counter", strconv.FormatUint(ent.Counter, 10))
+	}
+
+	label := ent.AccountName
+	if ent.Issuer != "" {
+		label = ent.Issuer + ":" + ent.AccountName
+	}
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     ent.Type,
+		Path:     "/" + label,
+		RawQuery: v.Encode(),
+	}
+	return u.String()
+}
+
+// Key returns the otp.Key of the entry. The entry must be revealed.
+func (ent TOTPEntry) Key() (*otp.Key, error) {
+	return otp.NewKeyFromURL(ent.URL())
+}
+
+// keyCounter returns the counter parameter of an HOTP key, zero if it has none.
+func keyCounter(k *otp.Key) uint64 {
+	counter, _ := strconv.ParseUint(keyQuery(k).Get("counter"), 10, 64)
+	return counter
+}
+
+// keyDigits returns the digits parameter of the key. Unlike otp.Key.Digits,
+// which knows only 6 and 8, it keeps other numbers of digits.
+func keyDigits(k *otp.Key) int {
+	if d, err := strconv.Atoi(keyQuery(k).Get("digits")); err == nil {
+		return d
+	}
+	return int(k.Digits())
+}
+
+// NewKey builds the otp.Key of an entry entered by hand, e.g. from a secret shown
+// by a service instead of a QR code. An empty type and algorithm default to TOTP
+// and SHA1, while zero digits and periods are reported like any other invalid value.
+// The entry is validated, a *ValidationError reports all its issues that are not
+// warnings, see ValidateEntry.
+func NewKey(ent TOTPEntry) (*otp.Key, error) {
+	if ent.Type == "" {
+		ent.Type = TypeTOTP
+	}
+	if ent.Algorithm == "" {
+		ent.Algorithm = otp.AlgorithmSHA1.String()
+	}
+	ent, issues := ValidateEntry(ent)
+	if err := IssuesError(issues); err != nil {
+		return nil, err
+	}
+	return ent.Key()
+}
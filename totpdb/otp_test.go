@@ -0,0 +1,35 @@
+package totpdb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewKey(t *testing.T) {
+	base := TOTPEntry{Issuer: "ACME", AccountName: "alice", Secret: "jbsw y3dp ehpk 3pxp", Digits: 6, Period: 30}
+
+	key, err := NewKey(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Empty type and algorithm take their defaults
+	if key.Type() != TypeTOTP || key.Algorithm().String() != "SHA1" || key.Secret() != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("got %s", key.URL())
+	}
+
+	tests := []struct {
+		name string
+		ent  func(ent TOTPEntry) TOTPEntry
+		err  error
+	}{
+		{"zero digits", func(ent TOTPEntry) TOTPEntry { ent.Digits = 0; return ent }, ErrInvalidDigits},
+		{"zero period", func(ent TOTPEntry) TOTPEntry { ent.Period = 0; return ent }, ErrInvalidPeriod},
+		{"hotp zero period", func(ent TOTPEntry) TOTPEntry { ent.Type, ent.Period = TypeHOTP, 0; return ent }, nil},
+		{"no account", func(ent TOTPEntry) TOTPEntry { ent.AccountName = ""; return ent }, ErrEmptyAccount},
+	}
+	for _, tt := range tests {
+		if _, err := NewKey(tt.ent(base)); !errors.Is(err, tt.err) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
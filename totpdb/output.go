@@ -0,0 +1,520 @@
+package totpdb
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/olekukonko/tablewriter"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrUnknownFormat = errors.New("unknown output format")
+	ErrUnknownColumn = errors.New("unknown column")
+)
+
+// Output formats.
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatYAML  = "yaml"
+	FormatCSV   = "csv"
+	FormatTSV   = "tsv"
+)
+
+// Formats lists the supported output formats.
+var Formats = []string{FormatTable, FormatJSON, FormatYAML, FormatCSV, FormatTSV}
+
+// CheckFormat returns ErrUnknownFormat if format is not one of Formats.
+func CheckFormat(format string) error {
+	for _, f := range Formats {
+		if f == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w %q, use one of %s", ErrUnknownFormat, format, strings.Join(Formats, ", "))
+}
+
+// EntryInfo is the metadata of an entry and optionally its codes, as written in all output formats.
+// It never holds the secret.
+type EntryInfo struct {
+	ID          string     `json:"id" yaml:"id"`
+	Issuer      string     `json:"issuer" yaml:"issuer"`
+	AccountName string     `json:"account_name" yaml:"account_name"`
+	Type        string     `json:"type" yaml:"type"`
+	Period      uint64     `json:"period" yaml:"period"`
+	Digits      int        `json:"digits" yaml:"digits"`
+	Algorithm   string     `json:"algorithm" yaml:"algorithm"`
+	Counter     uint64     `json:"counter,omitempty" yaml:"counter,omitempty"` // only for HOTP entries
+	Tags        []string   `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Group       string     `json:"group,omitempty" yaml:"group,omitempty"`
+	Notes       string     `json:"notes,omitempty" yaml:"notes,omitempty"`
+	Favorite    bool       `json:"favorite,omitempty" yaml:"favorite,omitempty"`
+	Icon        string     `json:"icon,omitempty" yaml:"icon,omitempty"`
+	Created     *time.Time `json:"created,omitempty" yaml:"created,omitempty"`
+	Modified    *time.Time `json:"modified,omitempty" yaml:"modified,omitempty"`
+	Used        *time.Time `json:"used,omitempty" yaml:"used,omitempty"`
+	Deleted     *time.Time `json:"deleted,omitempty" yaml:"deleted,omitempty"`   // only for trashed entries
+	PurgeAt     *time.Time `json:"purge_at,omitempty" yaml:"purge_at,omitempty"` // only for trashed entries
+	Code        string     `json:"code,omitempty" yaml:"code,omitempty"`
+	NextCode    string     `json:"next_code,omitempty" yaml:"next_code,omitempty"`
+	ValidFrom   *time.Time `json:"valid_from,omitempty" yaml:"valid_from,omitempty"`
+	ValidUntil  *time.Time `json:"valid_until,omitempty" yaml:"valid_until,omitempty"`
+	Remaining   int        `json:"remaining_seconds,omitempty" yaml:"remaining_seconds,omitempty"`
+}
+
+// Info returns the metadata of the entry.
+func (ent TOTPEntry) Info() EntryInfo {
+	return EntryInfo{
+		ID:          ent.ID,
+		Issuer:      ent.Issuer,
+		AccountName: ent.AccountName,
+		Type:        ent.Type,
+		Period:      ent.Period,
+		Digits:      ent.Digits,
+		Algorithm:   ent.Algorithm,
+		Counter:     ent.Counter,
+		Tags:        ent.Tags,
+		Group:       ent.Group,
+		Notes:       ent.Notes,
+		Favorite:    ent.Favorite,
+		Icon:        ent.Icon,
+		Created:     timeOrNil(ent.Created),
+		Modified:    timeOrNil(ent.Modified),
+		Used:        timeOrNil(ent.Used),
+	}
+}
+
+// TrashInfo returns the metadata of the trashed entry with the times it was deleted and is purged.
+func (data *TOTPData) TrashInfo(t TrashedEntry) EntryInfo {
+	info := t.Entry.Info()
+	info.Deleted = timeOrNil(t.Deleted)
+	info.PurgeAt = timeOrNil(data.PurgeAt(t))
+	return info
+}
+
+// CodeInfo returns the metadata of the entry together with its code at time t
+// and the time span the code is valid in. With next, the following code is included too.
+func (data *TOTPData) CodeInfo(ent TOTPEntry, t time.Time, next bool) (EntryInfo, error) {
+	info := ent.Info()
+	code, err := data.GenerateCode(ent, t)
+	if err != nil {
+		return info, err
+	}
+	remaining := ent.Remaining(t)
+	until := t.Add(remaining).Truncate(time.Second)
+	from := until.Add(-ent.PeriodDuration())
+
+	info.Code = code
+	info.ValidFrom = &from
+	info.ValidUntil = &until
+	info.Remaining = int((remaining + time.Second - 1) / time.Second)
+	if next {
+		if info.NextCode, err = data.GenerateCode(ent, until); err != nil {
+			return info, err
+		}
+	}
+	return info, nil
+}
+
+// column is a column of the table, CSV and TSV formats.
+type column struct {
+	title string // table header
+	key   string // CSV and TSV header, the same as the JSON key
+	extra bool   // left out of tables unless selected
+	trash bool   // left out unless selected, only set for trashed entries
+	code  bool   // needs the codes of the entry
+	value func(info EntryInfo, table bool) string
+}
+
+var (
+	allColumns = []column{
+		{title: "ID", key: "id", value: func(info EntryInfo, table bool) string {
+			if table {
+				return TOTPEntry{ID: info.ID}.ShortID()
+			}
+			return info.ID
+		}},
+		{title: "Issuer", key: "issuer", value: func(info EntryInfo, _ bool) string { return info.Issuer }},
+		{title: "Account Name", key: "account_name", value: func(info EntryInfo, _ bool) string { return info.AccountName }},
+		{title: "Type", key: "type", value: func(info EntryInfo, _ bool) string { return info.Type }},
+		{title: "Period", key: "period", value: func(info EntryInfo, _ bool) string { return strconv.FormatUint(info.Period, 10) }},
+		{title: "Digits", key: "digits", value: func(info EntryInfo, _ bool) string { return strconv.Itoa(info.Digits) }},
+		{title: "Algorithm", key: "algorithm", value: func(info EntryInfo, _ bool) string { return info.Algorithm }},
+		{title: "Counter", key: "counter", extra: true, value: func(info EntryInfo, _ bool) string { return strconv.FormatUint(info.Counter, 10) }},
+		{title: "Group", key: "group", value: func(info EntryInfo, _ bool) string { return info.Group }},
+		{title: "Tags", key: "tags", value: func(info EntryInfo, _ bool) string { return strings.Join(info.Tags, ",") }},
+		{title: "Fav", key: "favorite", value: func(info EntryInfo, table bool) string {
+			if table {
+				if info.Favorite {
+					return "*"
+				}
+				return ""
+			}
+			return strconv.FormatBool(info.Favorite)
+		}},
+		{title: "Notes", key: "notes", extra: true, value: func(info EntryInfo, _ bool) string { return info.Notes }},
+		{title: "Icon", key: "icon", extra: true, value: func(info EntryInfo, _ bool) string { return info.Icon }},
+		{title: "Created", key: "created", extra: true, value: timeColumn(func(info EntryInfo) *time.Time { return info.Created })},
+		{title: "Modified", key: "modified", extra: true, value: timeColumn(func(info EntryInfo) *time.Time { return info.Modified })},
+		{title: "Used", key: "used", extra: true, value: timeColumn(func(info EntryInfo) *time.Time { return info.Used })},
+		{title: "Deleted", key: "deleted", trash: true, value: timeColumn(func(info EntryInfo) *time.Time { return info.Deleted })},
+		{title: "Purge At", key: "purge_at", trash: true, value: timeColumn(func(info EntryInfo) *time.Time { return info.PurgeAt })},
+		{title: "Code", key: "code", code: true, value: func(info EntryInfo, _ bool) string { return orDash(info.Code) }},
+		{title: "Next", key: "next_code", code: true, value: func(info EntryInfo, _ bool) string { return orDash(info.NextCode) }},
+		{title: "Remaining", key: "valid_until", code: true, value: func(info EntryInfo, table bool) string {
+			switch {
+			case info.ValidUntil == nil:
+				return "-"
+			case table:
+				return fmt.Sprintf("%ds", info.Remaining)
+			}
+			return info.ValidUntil.Format(time.RFC3339)
+		}},
+	}
+
+	// columnAliases are short names of column keys.
+	columnAliases = map[string]string{
+		"account":   "account_name",
+		"next":      "next_code",
+		"remaining": "valid_until",
+	}
+)
+
+// ColumnKeys returns the keys of all columns, see ListOptions.Columns.
+func ColumnKeys() []string {
+	keys := make([]string, len(allColumns))
+	for i, col := range allColumns {
+		keys[i] = col.key
+	}
+	return keys
+}
+
+// timeColumn returns the value function of a column showing a time, "-" if it is not set.
+func timeColumn(field func(info EntryInfo) *time.Time) func(info EntryInfo, table bool) string {
+	return func(info EntryInfo, table bool) string {
+		t := field(info)
+		switch {
+		case t == nil:
+			return "-"
+		case table:
+			return t.Local().Format("2006-01-02 15:04")
+		}
+		return t.Format(time.RFC3339)
+	}
+}
+
+// timeOrNil returns a pointer to t, nil if t is zero.
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// orDash returns s, or "-" if it is empty.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// columns returns the columns selected by the options for the format.
+// Without a selection, these are the metadata columns, extra ones only outside tables,
+// and the code columns if opts.Codes is set.
+func (opts ListOptions) columns(format string) ([]column, error) {
+	var cols []column
+	if len(opts.Columns) > 0 {
+		for _, key := range opts.Columns {
+			key = strings.ToLower(strings.TrimSpace(key))
+			if alias, ok := columnAliases[key]; ok {
+				key = alias
+			}
+			ind := slices.IndexFunc(allColumns, func(col column) bool { return col.key == key })
+			if ind < 0 {
+				return nil, fmt.Errorf("%w %q, use one of %s", ErrUnknownColumn, key, strings.Join(ColumnKeys(), ", "))
+			}
+			cols = append(cols, allColumns[ind])
+		}
+		return cols, nil
+	}
+
+	for _, col := range allColumns {
+		switch {
+		case col.code && (!opts.Codes || (col.key == "next_code" && !opts.Next)):
+		case col.extra && format == FormatTable:
+		case col.trash:
+		default:
+			cols = append(cols, col)
+		}
+	}
+	return cols, nil
+}
+
+// needsCodes reports whether the selected columns show codes, and the next code.
+func (opts ListOptions) needsCodes() (codes, next bool) {
+	cols, err := opts.columns(FormatCSV)
+	if err != nil || len(opts.Columns) == 0 {
+		return opts.Codes || opts.Next, opts.Next
+	}
+	for _, col := range cols {
+		codes = codes || col.code
+		next = next || col.key == "next_code"
+	}
+	return codes, next
+}
+
+// WriteEntries writes the entries to w in the given format.
+// JSON and YAML get a list of objects, the other formats one row per entry.
+func WriteEntries(w io.Writer, format string, infos []EntryInfo, opts ListOptions) error {
+	switch format {
+	case FormatJSON:
+		return writeJSON(w, infos)
+	case FormatYAML:
+		return writeYAML(w, infos)
+	}
+	cols, err := opts.columns(format)
+	if err != nil {
+		return err
+	}
+	return writeRows(w, format, infos, cols)
+}
+
+// WriteEntry writes a single entry to w in the given format.
+// JSON and YAML get an object, the other formats a header and one row.
+func WriteEntry(w io.Writer, format string, info EntryInfo, opts ListOptions) error {
+	switch format {
+	case FormatJSON:
+		return writeJSON(w, info)
+	case FormatYAML:
+		return writeYAML(w, info)
+	}
+	cols, err := opts.columns(format)
+	if err != nil {
+		return err
+	}
+	return writeRows(w, format, []EntryInfo{info}, cols)
+}
+
+// WriteList writes plain values to w in the given format, one per line in the table format.
+// The CSV and TSV formats get a single column with the given header.
+func WriteList(w io.Writer, format, header string, values []string) error {
+	switch format {
+	case FormatTable:
+		for _, v := range values {
+			fmt.Fprintln(w, v)
+		}
+		return nil
+	case FormatJSON:
+		return writeJSON(w, values)
+	case FormatYAML:
+		return writeYAML(w, values)
+	}
+	if err := CheckFormat(format); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if format == FormatTSV {
+		cw.Comma = '\t'
+	}
+	cw.Write([]string{header})
+	for _, v := range values {
+		cw.Write([]string{v})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteValue writes a flat struct such as VerifyResult to w in the given format.
+// The CSV and TSV formats get a header of the JSON keys and one record,
+// the table format a line per field.
+func WriteValue(w io.Writer, format string, v any) error {
+	switch format {
+	case FormatJSON:
+		return writeJSON(w, v)
+	case FormatYAML:
+		return writeYAML(w, v)
+	}
+	if err := CheckFormat(format); err != nil {
+		return err
+	}
+
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	keys, fields := valueFields(rv.Type())
+	values := fieldStrings(rv, fields)
+	if format == FormatTable {
+		for i, key := range keys {
+			fmt.Fprintf(w, "%s: %s\n", key, values[i])
+		}
+		return nil
+	}
+	return writeRecords(w, format, keys, [][]string{values})
+}
+
+// WriteValues writes a slice of flat structs such as URLIssue to w in the given format.
+// The CSV and TSV formats get a header of the JSON keys and a record per value,
+// the table format a line per field and an empty line between values.
+func WriteValues(w io.Writer, format string, vs any) error {
+	switch format {
+	case FormatJSON:
+		return writeJSON(w, vs)
+	case FormatYAML:
+		return writeYAML(w, vs)
+	}
+	if err := CheckFormat(format); err != nil {
+		return err
+	}
+
+	rv := reflect.ValueOf(vs)
+	keys, fields := valueFields(rv.Type().Elem())
+	records := make([][]string, rv.Len())
+	for i := range records {
+		records[i] = fieldStrings(rv.Index(i), fields)
+	}
+	if format == FormatTable {
+		for i, values := range records {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			for j, key := range keys {
+				fmt.Fprintf(w, "%s: %s\n", key, values[j])
+			}
+		}
+		return nil
+	}
+	return writeRecords(w, format, keys, records)
+}
+
+// valueFields returns the JSON keys of the fields of a flat struct type and their indexes.
+func valueFields(t reflect.Type) (keys []string, fields []int) {
+	for i := 0; i < t.NumField(); i++ {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		keys = append(keys, key)
+		fields = append(fields, i)
+	}
+	return keys, fields
+}
+
+// fieldStrings formats the given fields of a struct value, see fieldString.
+func fieldStrings(rv reflect.Value, fields []int) []string {
+	values := make([]string, len(fields))
+	for i, f := range fields {
+		values[i] = fieldString(rv.Field(f))
+	}
+	return values
+}
+
+// writeRecords writes a header and records as CSV or TSV.
+func writeRecords(w io.Writer, format string, header []string, records [][]string) error {
+	cw := csv.NewWriter(w)
+	if format == FormatTSV {
+		cw.Comma = '\t'
+	}
+	cw.Write(header)
+	cw.WriteAll(records)
+	return cw.Error()
+}
+
+// fieldString formats a field for WriteValue, times as RFC 3339 and nil pointers as empty.
+func fieldString(f reflect.Value) string {
+	if f.Kind() == reflect.Pointer {
+		if f.IsNil() {
+			return ""
+		}
+		f = f.Elem()
+	}
+	if t, ok := f.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprint(f.Interface())
+}
+
+// writeJSON writes v as indented JSON.
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeYAML writes v as YAML.
+func writeYAML(w io.Writer, v any) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// CleanCell replaces tabs, line breaks and other control characters, which
+// would break the alignment of tables or drive the terminal, with spaces.
+func CleanCell(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// FitCell cleans s like CleanCell and fits it into width terminal columns,
+// cutting it short with an ellipsis or padding it with spaces.
+func FitCell(s string, width int) string {
+	return runewidth.FillRight(runewidth.Truncate(CleanCell(s), width, "…"), width)
+}
+
+// writeRows writes the entries as an ASCII table or as CSV or TSV records.
+func writeRows(w io.Writer, format string, infos []EntryInfo, cols []column) error {
+	if err := CheckFormat(format); err != nil {
+		return err
+	}
+	table := format == FormatTable
+
+	header := make([]string, len(cols))
+	for i, col := range cols {
+		header[i] = col.key
+		if table {
+			header[i] = col.title
+		}
+	}
+	rows := make([][]string, len(infos))
+	for i, info := range infos {
+		rows[i] = make([]string, len(cols))
+		for j, col := range cols {
+			rows[i][j] = col.value(info, table)
+			if table {
+				rows[i][j] = CleanCell(rows[i][j])
+			}
+		}
+	}
+
+	if table {
+		tw := tablewriter.NewWriter(w)
+		tw.SetHeader(header)
+		tw.AppendBulk(rows)
+		tw.Render()
+		return nil
+	}
+
+	cw := csv.NewWriter(w)
+	if format == FormatTSV {
+		cw.Comma = '\t'
+	}
+	cw.Write(header)
+	cw.WriteAll(rows)
+	return cw.Error()
+}
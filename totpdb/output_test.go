@@ -0,0 +1,159 @@
+package totpdb
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the tests")
+
+// goldenInfos are entries with the characters that need escaping or widen table cells.
+func goldenInfos() []EntryInfo {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	used := time.Date(2024, 5, 2, 8, 30, 0, 0, time.UTC)
+	from := time.Date(2024, 5, 2, 8, 30, 0, 0, time.UTC)
+	until := from.Add(30 * time.Second)
+	return []EntryInfo{
+		{
+			ID: "1f0c2a9e-0000-4000-8000-000000000001", Issuer: "GitHub", AccountName: "alice@example.com",
+			Type: TypeTOTP, Period: 30, Digits: 6, Algorithm: "SHA1",
+			Tags: []string{"work", "2fa"}, Group: "work/dev", Favorite: true,
+			Created: &created, Modified: &created, Used: &used,
+			Code: "123456", ValidFrom: &from, ValidUntil: &until, Remaining: 17,
+		},
+		{
+			ID: "2a7b3c4d-0000-4000-8000-000000000002", Issuer: "Acme, Inc.", AccountName: `bob "the builder"`,
+			Type: TypeTOTP, Period: 60, Digits: 8, Algorithm: "SHA256",
+			Notes: "backup codes\tin the safe", Icon: "acme.png",
+			Created: &created, Modified: &created,
+			Code: "12345678", ValidFrom: &from, ValidUntil: &until, Remaining: 5,
+		},
+		{
+			ID: "3c9d8e7f-0000-4000-8000-000000000003", Issuer: "Société Générale", AccountName: "jürgen",
+			Type: TypeHOTP, Digits: 6, Algorithm: "SHA512", Counter: 42,
+			Tags: []string{"bank"}, Group: "日本/東京",
+			Created: &created, Modified: &created,
+		},
+	}
+}
+
+// checkGolden compares got with the golden file, rewriting it with flag -update.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden file, run the tests with -update to create it: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from %s:\n--- got\n%s\n--- want\n%s", name, path, got, want)
+	}
+}
+
+func TestWriteEntriesGolden(t *testing.T) {
+	for _, format := range Formats {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteEntries(&buf, format, goldenInfos(), ListOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, "entries."+format, buf.Bytes())
+		})
+	}
+}
+
+func TestWriteEntriesCodesGolden(t *testing.T) {
+	opts := ListOptions{Codes: true}
+	for _, format := range []string{FormatTable, FormatCSV, FormatTSV} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteEntries(&buf, format, goldenInfos(), opts); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, "codes."+format, buf.Bytes())
+		})
+	}
+}
+
+func TestWriteEntriesColumnsGolden(t *testing.T) {
+	opts := ListOptions{Columns: []string{"id", "issuer", "account", "notes", "tags"}}
+	for _, format := range []string{FormatTable, FormatCSV, FormatTSV} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteEntries(&buf, format, goldenInfos(), opts); err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, "columns."+format, buf.Bytes())
+		})
+	}
+}
+
+func TestWriteEntriesErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteEntries(&buf, "xml", goldenInfos(), ListOptions{}); err == nil {
+		t.Error("unknown format accepted")
+	}
+	if err := WriteEntries(&buf, FormatCSV, goldenInfos(), ListOptions{Columns: []string{"secret"}}); err == nil {
+		t.Error("unknown column accepted")
+	}
+}
+
+func TestWriteValues(t *testing.T) {
+	issues := []URLIssue{
+		{Issuer: "ACME", AccountName: "alice", Field: "issuer", Detail: `is "ACME" in the entry but "Other" in the URL`},
+		{Issuer: "Bank", AccountName: "bob", Field: "digits", Detail: `is "6" in the entry but "8" in the URL`},
+	}
+	tests := []struct {
+		format string
+		vs     []URLIssue
+		want   string
+	}{
+		{FormatTSV, issues, "issuer\taccount_name\tfield\tdetail\n" +
+			"ACME\talice\tissuer\t\"is \"\"ACME\"\" in the entry but \"\"Other\"\" in the URL\"\n" +
+			"Bank\tbob\tdigits\t\"is \"\"6\"\" in the entry but \"\"8\"\" in the URL\"\n"},
+		{FormatTable, issues[1:], "issuer: Bank\naccount_name: bob\nfield: digits\ndetail: is \"6\" in the entry but \"8\" in the URL\n"},
+		// The header and an empty list are written without values
+		{FormatCSV, []URLIssue{}, "issuer,account_name,field,detail\n"},
+		{FormatJSON, []URLIssue{}, "[]\n"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := WriteValues(&buf, tt.format, tt.vs); err != nil {
+			t.Fatalf("%s: %v", tt.format, err)
+		}
+		if buf.String() != tt.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tt.format, buf.String(), tt.want)
+		}
+	}
+	if err := WriteValues(&bytes.Buffer{}, "xml", issues); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
+
+func TestFitCell(t *testing.T) {
+	tests := []struct {
+		in    string
+		width int
+		want  string
+	}{
+		{"ACME", 6, "ACME  "},
+		{"ACME Corporation", 8, "ACME Co…"},
+		{"a\tb\x1b[2J", 8, "a b [2J "},
+		{"東京銀行", 6, "東京… "},
+	}
+	for _, tt := range tests {
+		if got := FitCell(tt.in, tt.width); got != tt.want {
+			t.Errorf("FitCell(%q, %d) = %q, want %q", tt.in, tt.width, got, tt.want)
+		}
+	}
+}
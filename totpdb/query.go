@@ -0,0 +1,253 @@
+package totpdb
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrUnknownSort   = errors.New("unknown sort key")
+	ErrInvalidFilter = errors.New("invalid filter")
+	ErrInvalidLimit  = errors.New("limit must not be negative")
+)
+
+// Keys entries can be sorted by.
+const (
+	SortIssuer   = "issuer"
+	SortAccount  = "account"
+	SortGroup    = "group"
+	SortFavorite = "favorite" // favorites first
+	SortCreated  = "created"  // oldest first
+	SortUsed     = "used"     // most recently used first, never used last
+)
+
+// SortKeys lists the keys entries can be sorted by.
+var SortKeys = []string{SortIssuer, SortAccount, SortGroup, SortFavorite, SortCreated, SortUsed}
+
+// Query selects entries of the database and their order.
+// The zero Query selects all entries in their stored order.
+type Query struct {
+	Tags    []string // only entries with all these tags
+	Group   string   // only entries in this group or its subgroups
+	Filters []Filter // only entries matching all filters
+	Sort    string   // one of SortKeys, prefixed by "-" to reverse; stored order if empty
+	Limit   int      // at most this many entries, all if zero
+}
+
+// Filter is a condition on a field of an entry, see ParseFilter.
+type Filter struct {
+	Field string
+	Op    string
+	Value string
+}
+
+// Filter operators. Comparisons ignore case.
+const (
+	OpEqual       = "="
+	OpNotEqual    = "!="
+	OpContains    = "~"
+	OpNotContains = "!~"
+)
+
+// filterFields returns the values of the filterable fields of an entry.
+// A filter on a field with several values, i.e. tag, matches if any value matches.
+var filterFields = map[string]func(ent TOTPEntry) []string{
+	"id":        func(ent TOTPEntry) []string { return []string{ent.ID} },
+	"issuer":    func(ent TOTPEntry) []string { return []string{ent.Issuer} },
+	"account":   func(ent TOTPEntry) []string { return []string{ent.AccountName} },
+	"type":      func(ent TOTPEntry) []string { return []string{ent.Type} },
+	"period":    func(ent TOTPEntry) []string { return []string{strconv.FormatUint(ent.Period, 10)} },
+	"digits":    func(ent TOTPEntry) []string { return []string{strconv.Itoa(ent.Digits)} },
+	"algorithm": func(ent TOTPEntry) []string { return []string{ent.Algorithm} },
+	"group":     func(ent TOTPEntry) []string { return []string{ent.Group} },
+	"tag":       func(ent TOTPEntry) []string { return ent.Tags },
+	"notes":     func(ent TOTPEntry) []string { return []string{ent.Notes} },
+	"favorite":  func(ent TOTPEntry) []string { return []string{strconv.FormatBool(ent.Favorite)} },
+	"icon":      func(ent TOTPEntry) []string { return []string{ent.Icon} },
+}
+
+// FilterFields returns the names of the fields filters can test, sorted.
+func FilterFields() []string {
+	fields := make([]string, 0, len(filterFields))
+	for f := range filterFields {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// ParseFilter parses a filter expression of space separated conditions such as
+// "issuer~github type=hotp". A condition is a field name, an operator out of
+// =, !=, ~ (contains) and !~ (does not contain), and a value that may be empty.
+func ParseFilter(expr string) ([]Filter, error) {
+	var filters []Filter
+	for _, cond := range strings.Fields(expr) {
+		pos := strings.IndexAny(cond, "!=~")
+		if pos < 1 {
+			return nil, fmt.Errorf("%w %q, use FIELD=VALUE, FIELD!=VALUE, FIELD~VALUE or FIELD!~VALUE", ErrInvalidFilter, cond)
+		}
+		op := cond[pos : pos+1]
+		if op == "!" {
+			op = cond[pos:min(pos+2, len(cond))]
+			if op != OpNotEqual && op != OpNotContains {
+				return nil, fmt.Errorf("%w %q, unknown operator", ErrInvalidFilter, cond)
+			}
+		}
+		field := strings.ToLower(cond[:pos])
+		if _, ok := filterFields[field]; !ok {
+			return nil, fmt.Errorf("%w %q, unknown field %q, use one of %s",
+				ErrInvalidFilter, cond, field, strings.Join(FilterFields(), ", "))
+		}
+		filters = append(filters, Filter{Field: field, Op: op, Value: cond[pos+len(op):]})
+	}
+	return filters, nil
+}
+
+// Match reports whether the entry satisfies the filter.
+func (f Filter) Match(ent TOTPEntry) bool {
+	value := strings.ToLower(f.Value)
+	matches := func(v string) bool {
+		v = strings.ToLower(v)
+		if f.Op == OpContains || f.Op == OpNotContains {
+			return strings.Contains(v, value)
+		}
+		return v == value
+	}
+
+	values := filterFields[f.Field](ent)
+	// Entries without tags have no value to test, but "tag=" should match them
+	if len(values) == 0 {
+		values = []string{""}
+	}
+	found := false
+	for _, v := range values {
+		found = found || matches(v)
+	}
+	if f.Op == OpNotEqual || f.Op == OpNotContains {
+		return !found
+	}
+	return found
+}
+
+// Match reports whether the entry satisfies the tag, group and filter conditions of the query.
+func (q Query) Match(ent TOTPEntry) bool {
+	if q.Group != "" && !ent.InGroup(q.Group) {
+		return false
+	}
+	for _, tag := range q.Tags {
+		if !ent.HasTag(tag) {
+			return false
+		}
+	}
+	for _, f := range q.Filters {
+		if !f.Match(ent) {
+			return false
+		}
+	}
+	return true
+}
+
+// entryLess returns the order of entries for the sort key, nil for an unknown key.
+// Ties are broken by issuer and then account name, ignoring case.
+func entryLess(key string) func(a, b TOTPEntry) bool {
+	byName := func(a, b TOTPEntry) bool {
+		ai, bi := strings.ToLower(a.Issuer), strings.ToLower(b.Issuer)
+		if ai != bi {
+			return ai < bi
+		}
+		return strings.ToLower(a.AccountName) < strings.ToLower(b.AccountName)
+	}
+	switch key {
+	case SortIssuer:
+		return byName
+	case SortAccount:
+		return func(a, b TOTPEntry) bool {
+			aa, ba := strings.ToLower(a.AccountName), strings.ToLower(b.AccountName)
+			if aa != ba {
+				return aa < ba
+			}
+			return byName(a, b)
+		}
+	case SortGroup:
+		return func(a, b TOTPEntry) bool {
+			if a.Group != b.Group {
+				return a.Group < b.Group
+			}
+			return byName(a, b)
+		}
+	case SortFavorite:
+		return func(a, b TOTPEntry) bool {
+			if a.Favorite != b.Favorite {
+				return a.Favorite
+			}
+			return byName(a, b)
+		}
+	case SortCreated:
+		return func(a, b TOTPEntry) bool {
+			if !a.Created.Equal(b.Created) {
+				return a.Created.Before(b.Created)
+			}
+			return byName(a, b)
+		}
+	case SortUsed:
+		return func(a, b TOTPEntry) bool {
+			if !a.Used.Equal(b.Used) {
+				return a.Used.After(b.Used)
+			}
+			return byName(a, b)
+		}
+	}
+	return nil
+}
+
+// Select returns the indexes of the entries selected by the query, in the order it asks for.
+// Commands that change several entries at once work on the returned indexes.
+func (data *TOTPData) Select(q Query) ([]int, error) {
+	if q.Limit < 0 {
+		return nil, fmt.Errorf("%w, not %d", ErrInvalidLimit, q.Limit)
+	}
+	var less func(a, b TOTPEntry) bool
+	if q.Sort != "" {
+		key, reverse := strings.CutPrefix(q.Sort, "-")
+		if less = entryLess(key); less == nil {
+			return nil, fmt.Errorf("%w %q, use one of %s, prefixed by - to reverse",
+				ErrUnknownSort, q.Sort, strings.Join(SortKeys, ", "))
+		}
+		if reverse {
+			forward := less
+			less = func(a, b TOTPEntry) bool { return forward(b, a) }
+		}
+	}
+
+	selected := make([]int, 0, len(data.Entries))
+	for ind, ent := range data.Entries {
+		if q.Match(ent) {
+			selected = append(selected, ind)
+		}
+	}
+	if less != nil {
+		sort.SliceStable(selected, func(i, j int) bool {
+			return less(data.Entries[selected[i]], data.Entries[selected[j]])
+		})
+	}
+	if q.Limit > 0 && len(selected) > q.Limit {
+		selected = selected[:q.Limit]
+	}
+	return selected, nil
+}
+
+// ListEntries returns the entries selected by the query, in the order it asks for.
+func (data *TOTPData) ListEntries(q Query) ([]TOTPEntry, error) {
+	selected, err := data.Select(q)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]TOTPEntry, len(selected))
+	for i, ind := range selected {
+		entries[i] = data.Entries[ind]
+	}
+	return entries, nil
+}
@@ -0,0 +1,104 @@
+package totpdb
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		expr string
+		want []Filter
+	}{
+		{"", nil},
+		{"issuer~git", []Filter{{"issuer", OpContains, "git"}}},
+		{"Type=hotp  tag!=work", []Filter{{"type", OpEqual, "hotp"}, {"tag", OpNotEqual, "work"}}},
+		{"notes!~backup group=", []Filter{{"notes", OpNotContains, "backup"}, {"group", OpEqual, ""}}},
+		{"account=a=b", []Filter{{"account", OpEqual, "a=b"}}},
+	}
+	for _, tt := range tests {
+		got, err := ParseFilter(tt.expr)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseFilter(%q) = %v, %v, want %v", tt.expr, got, err, tt.want)
+		}
+	}
+
+	for _, expr := range []string{"issuer", "=github", "issuer!github", "secret=x", "issuer=a account"} {
+		if _, err := ParseFilter(expr); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("ParseFilter(%q): got error %v, want %v", expr, err, ErrInvalidFilter)
+		}
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	ent := TOTPEntry{Issuer: "GitHub", AccountName: "alice", Tags: []string{"work", "dev"}}
+	untagged := TOTPEntry{Issuer: "Bank", AccountName: "bob"}
+	tests := []struct {
+		expr      string
+		ent       TOTPEntry
+		wantMatch bool
+	}{
+		{"issuer=github", ent, true},
+		{"issuer~HUB", ent, true},
+		{"issuer!~hub", ent, false},
+		{"tag=dev", ent, true},
+		{"tag!=dev", ent, false},
+		{"tag=", untagged, true},
+		{"tag!=work", untagged, true},
+		{"issuer=github account=bob", ent, false},
+	}
+	for _, tt := range tests {
+		q := Query{}
+		var err error
+		if q.Filters, err = ParseFilter(tt.expr); err != nil {
+			t.Fatal(err)
+		}
+		if got := q.Match(tt.ent); got != tt.wantMatch {
+			t.Errorf("%q on %s: got %v, want %v", tt.expr, tt.ent.AccountName, got, tt.wantMatch)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	data := &TOTPData{Entries: []TOTPEntry{
+		{Issuer: "bank", AccountName: "carol", Group: "money", Created: day(3), Used: day(9)},
+		{Issuer: "ACME", AccountName: "bob", Group: "work/dev", Favorite: true, Created: day(1), Tags: []string{"ci"}},
+		{Issuer: "ACME", AccountName: "Alice", Group: "work", Created: day(2), Used: day(8), Tags: []string{"ci"}},
+		{Issuer: "Zed", AccountName: "alice", Created: day(4), Used: day(7)},
+	}}
+
+	tests := []struct {
+		name string
+		q    Query
+		want []int
+	}{
+		{"stored order", Query{}, []int{0, 1, 2, 3}},
+		{"issuer ignores case, then account", Query{Sort: SortIssuer}, []int{2, 1, 0, 3}},
+		{"account, then issuer", Query{Sort: SortAccount}, []int{2, 3, 1, 0}},
+		{"group", Query{Sort: SortGroup}, []int{3, 0, 2, 1}},
+		{"favorites first", Query{Sort: SortFavorite}, []int{1, 2, 0, 3}},
+		{"oldest first", Query{Sort: SortCreated}, []int{1, 2, 0, 3}},
+		{"newest first", Query{Sort: "-" + SortCreated}, []int{3, 0, 2, 1}},
+		{"recently used first, never used last", Query{Sort: SortUsed}, []int{0, 2, 3, 1}},
+		{"limit after sorting", Query{Sort: SortIssuer, Limit: 2}, []int{2, 1}},
+		{"limit above the count", Query{Limit: 9}, []int{0, 1, 2, 3}},
+		{"group and subgroups", Query{Group: "work"}, []int{1, 2}},
+		{"tags", Query{Tags: []string{"ci"}, Sort: SortAccount}, []int{2, 1}},
+	}
+	for _, tt := range tests {
+		got, err := data.Select(tt.q)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+
+	if _, err := data.Select(Query{Sort: "name"}); !errors.Is(err, ErrUnknownSort) {
+		t.Errorf("got error %v for an unknown sort key, want %v", err, ErrUnknownSort)
+	}
+	if _, err := data.Select(Query{Limit: -1}); !errors.Is(err, ErrInvalidLimit) {
+		t.Errorf("got error %v for a negative limit, want %v", err, ErrInvalidLimit)
+	}
+}
@@ -0,0 +1,199 @@
+package totpdb
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+var (
+	ErrInvalidRecoveryKey = errors.New("invalid recovery key")
+	ErrNoRecoverySlot     = errors.New("database has no recovery key")
+)
+
+// SlotRecovery is the kind of the key slot wrapped by a recovery key.
+const SlotRecovery = "recovery"
+
+const (
+	recoveryKeySize  = 20 // 160 bits
+	recoveryKeyWords = 15 // BIP39 words of 160 bits with a 5 bit checksum
+)
+
+var (
+	recoveryX25519Salt = []byte("totp-cli recovery x25519 key")
+	recoverySlotInfo   = []byte("totp-cli recovery slot")
+)
+
+// GenerateRecoveryKey returns a new random recovery key as a phrase of 15 words
+// of the BIP39 English word list, which is easier to write down and type than
+// random characters. The last word carries a checksum that catches typos.
+func GenerateRecoveryKey() (string, error) {
+	key := make([]byte, recoveryKeySize)
+	defer Wipe(key)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return bip39.NewMnemonic(key)
+}
+
+// parseRecoveryKey decodes a recovery key phrase, ignoring case and extra spaces.
+func parseRecoveryKey(code []byte) ([]byte, error) {
+	words := strings.Fields(strings.ToLower(string(code)))
+	if len(words) != recoveryKeyWords {
+		return nil, fmt.Errorf("%w: got %d words, want %d", ErrInvalidRecoveryKey, len(words), recoveryKeyWords)
+	}
+	for i, word := range words {
+		if _, ok := bip39.GetWordIndex(word); !ok {
+			return nil, fmt.Errorf("%w: word %d is not in the word list", ErrInvalidRecoveryKey, i+1)
+		}
+	}
+	key, err := bip39.EntropyFromMnemonic(strings.Join(words, " "))
+	if err != nil || len(key) != recoveryKeySize {
+		return nil, fmt.Errorf("%w: the checksum does not match, check the words and their order", ErrInvalidRecoveryKey)
+	}
+	return key, nil
+}
+
+// recoveryPrivateKey derives the X25519 private key of the recovery slot from a recovery key.
+func recoveryPrivateKey(code []byte) ([]byte, error) {
+	key, err := parseRecoveryKey(code)
+	if err != nil {
+		return nil, err
+	}
+	defer Wipe(key)
+	return DeriveKey(key, recoveryX25519Salt, curve25519.ScalarSize), nil
+}
+
+// recoverySlotKEK derives the key wrapping the data key from the X25519 shared
+// secret of the ephemeral and the recovery key.
+func recoverySlotKEK(shared, ephemeral, public []byte) ([]byte, error) {
+	kek := make([]byte, 32)
+	salt := append(append([]byte{}, ephemeral...), public...)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, recoverySlotInfo), kek); err != nil {
+		return nil, err
+	}
+	return kek, nil
+}
+
+// wrapRecovery wraps the data key to the X25519 public key of a recovery key,
+// so that the data key can be wrapped again without the recovery key, see rotate.
+// The result is the ephemeral public key followed by the encrypted data key.
+func wrapRecovery(dataKey, public []byte) ([]byte, error) {
+	ephemeral := make([]byte, curve25519.ScalarSize)
+	defer Wipe(ephemeral)
+	if _, err := io.ReadFull(rand.Reader, ephemeral); err != nil {
+		return nil, err
+	}
+	ephemeralPublic, err := curve25519.X25519(ephemeral, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := curve25519.X25519(ephemeral, public)
+	if err != nil {
+		return nil, err
+	}
+	defer Wipe(shared)
+	kek, err := recoverySlotKEK(shared, ephemeralPublic, public)
+	if err != nil {
+		return nil, err
+	}
+	defer Wipe(kek)
+
+	wrapped, err := Encrypt(dataKey, kek)
+	if err != nil {
+		return nil, err
+	}
+	return append(ephemeralPublic, wrapped...), nil
+}
+
+// unwrapRecovery recovers the data key from a recovery slot with the recovery key.
+func unwrapRecovery(slot KeySlot, code []byte) (*Secret, error) {
+	private, err := recoveryPrivateKey(code)
+	if err != nil {
+		return nil, err
+	}
+	defer Wipe(private)
+	if len(slot.Wrapped) < curve25519.PointSize {
+		return nil, ErrInvalidDatabaseFile
+	}
+	ephemeralPublic := slot.Wrapped[:curve25519.PointSize]
+	shared, err := curve25519.X25519(private, ephemeralPublic)
+	if err != nil {
+		return nil, ErrInvalidRecoveryKey
+	}
+	defer Wipe(shared)
+	kek, err := recoverySlotKEK(shared, ephemeralPublic, slot.Public)
+	if err != nil {
+		return nil, err
+	}
+	defer Wipe(kek)
+	key, err := Decrypt(slot.Wrapped[curve25519.PointSize:], kek)
+	if err != nil {
+		return nil, ErrInvalidRecoveryKey
+	}
+	return NewSecretFrom(key), nil
+}
+
+// SetRecoveryKey wraps the data key with the recovery key, replacing any previous one.
+func (data *TOTPData) SetRecoveryKey(code []byte) error {
+	private, err := recoveryPrivateKey(code)
+	if err != nil {
+		return err
+	}
+	defer Wipe(private)
+	public, err := curve25519.X25519(private, curve25519.Basepoint)
+	if err != nil {
+		return err
+	}
+	kr, err := data.keyring()
+	if err != nil {
+		return err
+	}
+	wrapped, err := wrapRecovery(kr.dataKey.Bytes(), public)
+	if err != nil {
+		return err
+	}
+	kr.setSlot(KeySlot{Kind: SlotRecovery, Public: public, Wrapped: wrapped})
+	return nil
+}
+
+// HasRecoveryKey reports whether the database can be unlocked with a recovery key.
+func (data *TOTPData) HasRecoveryKey() bool {
+	return data.keys != nil && data.keys.findSlot(SlotRecovery, "") >= 0
+}
+
+// ReadCBORSecRecovery reads the encrypted CBOR data from the file and decrypts it
+// with the data key wrapped by the recovery key.
+func ReadCBORSecRecovery(filename string, code []byte) (*TOTPData, error) {
+	encryptedData, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	vf, ok, err := decodeVault(encryptedData)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNoRecoverySlot
+	}
+
+	for _, slot := range vf.Slots {
+		if slot.Kind == SlotRecovery {
+			key, err := unwrapRecovery(slot, code)
+			if err != nil {
+				return nil, err
+			}
+			return openVault(vf, key)
+		}
+	}
+	return nil, ErrNoRecoverySlot
+}
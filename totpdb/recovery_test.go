@@ -0,0 +1,110 @@
+package totpdb
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+func TestGenerateRecoveryKey(t *testing.T) {
+	code, err := GenerateRecoveryKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := strings.Fields(code)
+	if len(words) != recoveryKeyWords {
+		t.Fatalf("got %d words in %q, want %d", len(words), code, recoveryKeyWords)
+	}
+	for _, word := range words {
+		if _, ok := bip39.GetWordIndex(word); !ok {
+			t.Errorf("word %q is not in the word list", word)
+		}
+	}
+	key, err := parseRecoveryKey([]byte(code))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != recoveryKeySize {
+		t.Errorf("got %d bytes, want %d", len(key), recoveryKeySize)
+	}
+}
+
+func TestParseRecoveryKey(t *testing.T) {
+	key := []byte("0123456789abcdefghij")
+	phrase, err := bip39.NewMnemonic(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	words := strings.Fields(phrase)
+
+	valid := []string{
+		phrase,
+		"  " + strings.ToUpper(strings.Join(words, "  \n")) + "\n",
+	}
+	for _, code := range valid {
+		got, err := parseRecoveryKey([]byte(code))
+		if err != nil {
+			t.Errorf("parseRecoveryKey(%q): %v", code, err)
+		} else if !bytes.Equal(got, key) {
+			t.Errorf("parseRecoveryKey(%q) = %x, want %x", code, got, key)
+		}
+	}
+
+	// A word of the list in the wrong place fails the checksum
+	swapped := append([]string{}, words...)
+	swapped[0], swapped[1] = swapped[1], swapped[0]
+	invalid := map[string]string{
+		"unknown word": strings.Join(append([]string{"notaword"}, words[1:]...), " "),
+		"checksum":     strings.Join(swapped, " "),
+		"too few":      strings.Join(words[:12], " "),
+		"base32":       "GAYTEMZUGU3DOOBZMFRGGZDFMZTWQ2LK",
+	}
+	for name, code := range invalid {
+		if _, err := parseRecoveryKey([]byte(code)); !errors.Is(err, ErrInvalidRecoveryKey) {
+			t.Errorf("%s: got error %v, want %v", name, err, ErrInvalidRecoveryKey)
+		}
+	}
+}
+
+func TestRecoveryKeyUnlock(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "entries.db")
+	password, salt := []byte("pw"), []byte("salt")
+	data := &TOTPData{Entries: []TOTPEntry{{Issuer: "ACME", AccountName: "alice", Type: TypeTOTP, Secret: "JBSWY3DPEHPK3PXP"}}}
+	if err := WriteCBORSec(filename, data, password, salt); err != nil {
+		t.Fatal(err)
+	}
+	code, err := GenerateRecoveryKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := data.SetRecoveryKey([]byte(code)); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteCBORSec(filename, data, password, salt); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := ReadCBORSecRecovery(filename, []byte(strings.ToUpper(code)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ent, err := read.RevealEntry(read.Entries[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ent.Secret != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("got secret %q", ent.Secret)
+	}
+
+	other, err := GenerateRecoveryKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadCBORSecRecovery(filename, []byte(other)); !errors.Is(err, ErrInvalidRecoveryKey) {
+		t.Errorf("got error %v for another recovery key, want %v", err, ErrInvalidRecoveryKey)
+	}
+}
@@ -0,0 +1,124 @@
+package totpdb
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+
+	"github.com/fxamacker/cbor/v2"
+	"golang.org/x/crypto/hkdf"
+)
+
+var ErrEntryLocked = errors.New("entry is sealed and the database key is not available")
+
+// entryKeyInfo separates the entry sub-key from other keys derived from the data key.
+var entryKeyInfo = []byte("totp-cli entry key")
+
+// entrySecrets is the sealed part of a TOTPEntry.
+type entrySecrets struct {
+	Secret    string `cbor:"secret"`
+	LegacyURL string `cbor:"url,omitempty"`
+}
+
+// entryKey returns the sub-key used to seal the secrets of single entries,
+// deriving it from the data key on first use.
+func (kr *keyring) entryKey() (*Secret, error) {
+	if kr.subKey.Len() > 0 {
+		return kr.subKey, nil
+	}
+	if kr.dataKey.Len() == 0 {
+		return nil, ErrDatabaseClosed
+	}
+	key := NewSecret(32)
+	r := hkdf.New(sha256.New, kr.dataKey.Bytes(), nil, entryKeyInfo)
+	if _, err := io.ReadFull(r, key.Bytes()); err != nil {
+		key.Destroy()
+		return nil, err
+	}
+	kr.subKey = key
+	return key, nil
+}
+
+// sealEntry encrypts the secret and legacy URL of the entry with the entry sub-key
+// and clears them from the entry.
+func sealEntry(ent *TOTPEntry, key []byte) error {
+	plain, err := cbor.Marshal(entrySecrets{Secret: ent.Secret, LegacyURL: ent.LegacyURL})
+	if err != nil {
+		return err
+	}
+	defer Wipe(plain)
+
+	sealed, err := Encrypt(plain, key)
+	if err != nil {
+		return err
+	}
+	ent.Sealed = sealed
+	ent.Secret = ""
+	ent.LegacyURL = ""
+	return nil
+}
+
+// sealEntries seals every entry, in the trash too, that still holds its secret
+// in plaintext, as entries of legacy databases and newly added ones do.
+func (data *TOTPData) sealEntries() error {
+	kr, err := data.keyring()
+	if err != nil {
+		return err
+	}
+	key, err := kr.entryKey()
+	if err != nil {
+		return err
+	}
+	for ind := range data.Entries {
+		if data.Entries[ind].IsSealed() {
+			continue
+		}
+		if err := sealEntry(&data.Entries[ind], key.Bytes()); err != nil {
+			return err
+		}
+	}
+	for ind := range data.Trash {
+		if data.Trash[ind].Entry.IsSealed() {
+			continue
+		}
+		if err := sealEntry(&data.Trash[ind].Entry, key.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsSealed reports whether the secret of the entry is encrypted.
+func (ent TOTPEntry) IsSealed() bool {
+	return len(ent.Sealed) > 0
+}
+
+// RevealEntry returns a copy of the entry with its secret decrypted.
+// Only the given entry is decrypted, all others stay sealed.
+func (data *TOTPData) RevealEntry(ent TOTPEntry) (TOTPEntry, error) {
+	if !ent.IsSealed() {
+		return ent, nil
+	}
+	if data.keys == nil {
+		return TOTPEntry{}, ErrEntryLocked
+	}
+	key, err := data.keys.entryKey()
+	if err != nil {
+		return TOTPEntry{}, err
+	}
+
+	plain, err := Decrypt(ent.Sealed, key.Bytes())
+	if err != nil {
+		return TOTPEntry{}, err
+	}
+	defer Wipe(plain)
+
+	var sec entrySecrets
+	if err := cbor.Unmarshal(plain, &sec); err != nil {
+		return TOTPEntry{}, err
+	}
+	ent.Secret = sec.Secret
+	ent.LegacyURL = sec.LegacyURL
+	ent.Sealed = nil
+	return ent, nil
+}
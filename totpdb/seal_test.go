@@ -0,0 +1,152 @@
+package totpdb
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+const sealSecret = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+
+// sealedTestDB writes a database with two entries and a trashed one and returns
+// its path and the written data.
+func sealedTestDB(t *testing.T, password, salt []byte) (string, *TOTPData) {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "entries.db")
+	data := &TOTPData{
+		Entries: []TOTPEntry{
+			{Issuer: "ACME", AccountName: "alice", Type: TypeTOTP, Secret: sealSecret},
+			{Issuer: "Bank", AccountName: "bob", Type: TypeHOTP, Secret: "GEZDGNBVGY3TQOJQ", LegacyURL: "otpauth://hotp/Bank:bob"},
+		},
+		Trash: []TrashedEntry{{Entry: TOTPEntry{ID: "3c0ffee0", AccountName: "carol", Type: TypeTOTP, Secret: sealSecret}, Deleted: time.Now()}},
+	}
+	if err := WriteCBORSec(filename, data, password, salt); err != nil {
+		t.Fatal(err)
+	}
+	return filename, data
+}
+
+// allEntries returns the entries and the trashed entries of the data.
+func allEntries(data *TOTPData) []TOTPEntry {
+	all := append([]TOTPEntry{}, data.Entries...)
+	for _, tr := range data.Trash {
+		all = append(all, tr.Entry)
+	}
+	return all
+}
+
+func TestSealRoundTrip(t *testing.T) {
+	password, salt := []byte("pw"), []byte("salt")
+	filename, data := sealedTestDB(t, password, salt)
+
+	// Writing seals every entry, so the decrypted payload holds no secret either
+	for _, ent := range allEntries(data) {
+		if !ent.IsSealed() || ent.Secret != "" || ent.LegacyURL != "" {
+			t.Errorf("%s not sealed: %+v", ent.AccountName, ent)
+		}
+	}
+	payload, err := cbor.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(payload, []byte(sealSecret)) || bytes.Contains(payload, []byte("otpauth://")) {
+		t.Error("payload holds a secret in plaintext")
+	}
+
+	read, err := ReadCBORSec(filename, password, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][2]string{
+		"alice": {sealSecret, ""},
+		"bob":   {"GEZDGNBVGY3TQOJQ", "otpauth://hotp/Bank:bob"},
+		"carol": {sealSecret, ""},
+	}
+	for _, sealed := range allEntries(read) {
+		ent, err := read.RevealEntry(sealed)
+		if err != nil {
+			t.Fatalf("%s: %v", sealed.AccountName, err)
+		}
+		if got := [2]string{ent.Secret, ent.LegacyURL}; got != want[ent.AccountName] {
+			t.Errorf("%s: got %q, want %q", ent.AccountName, got, want[ent.AccountName])
+		}
+		if ent.IsSealed() {
+			t.Errorf("%s: revealed entry still sealed", ent.AccountName)
+		}
+	}
+
+	// Without the keys nothing is revealed
+	if _, err := (&TOTPData{}).RevealEntry(read.Entries[0]); !errors.Is(err, ErrEntryLocked) {
+		t.Errorf("got error %v without keys, want %v", err, ErrEntryLocked)
+	}
+}
+
+func TestSealRejectsTampering(t *testing.T) {
+	password, salt := []byte("pw"), []byte("salt")
+	_, data := sealedTestDB(t, password, salt)
+
+	ent := data.Entries[0]
+	for _, pos := range []int{0, len(ent.Sealed) / 2, len(ent.Sealed) - 1} {
+		tampered := ent
+		tampered.Sealed = bytes.Clone(ent.Sealed)
+		tampered.Sealed[pos] ^= 0x01
+		if revealed, err := data.RevealEntry(tampered); err == nil {
+			t.Errorf("tampering with byte %d accepted, revealed %q", pos, revealed.Secret)
+		}
+	}
+	truncated := ent
+	truncated.Sealed = ent.Sealed[:len(ent.Sealed)-1]
+	if _, err := data.RevealEntry(truncated); err == nil {
+		t.Error("truncated blob accepted")
+	}
+}
+
+func TestRotateKeyReseals(t *testing.T) {
+	password, salt := []byte("pw"), []byte("salt")
+	filename, data := sealedTestDB(t, password, salt)
+
+	oldKey, err := data.keys.entryKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldEntryKey := bytes.Clone(oldKey.Bytes())
+	before := allEntries(data)
+
+	if err := data.RotateKey(password, salt); err != nil {
+		t.Fatal(err)
+	}
+	after := allEntries(data)
+	if len(after) != len(before) {
+		t.Fatalf("got %d entries after rotation, want %d", len(after), len(before))
+	}
+	for i, ent := range after {
+		if !ent.IsSealed() || bytes.Equal(ent.Sealed, before[i].Sealed) {
+			t.Errorf("%s not sealed again", ent.AccountName)
+		}
+		// The old entry key no longer opens it
+		if _, err := Decrypt(ent.Sealed, oldEntryKey); err == nil {
+			t.Errorf("%s still opens with the old key", ent.AccountName)
+		}
+	}
+
+	if err := WriteCBORSec(filename, data, password, salt); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadCBORSec(filename, password, salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sealed := range allEntries(read) {
+		ent, err := read.RevealEntry(sealed)
+		if err != nil {
+			t.Fatalf("%s: %v", sealed.AccountName, err)
+		}
+		if ent.Secret == "" {
+			t.Errorf("%s lost its secret", ent.AccountName)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package totpdb
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Scores of the kinds of fuzzy matches, a better kind always ranks higher.
+const (
+	scoreExact       = 1000
+	scorePrefix      = 800
+	scoreSubstring   = 600
+	scoreSubsequence = 300
+)
+
+// Match is an entry that matches a search query.
+type Match struct {
+	Index int // index in TOTPData.Entries
+	Score int
+}
+
+// FuzzyScore scores how well query matches text, ignoring case.
+//
+// Exact matches rank over prefixes, prefixes over substrings and substrings
+// over subsequences, i.e. the query characters appearing in order with gaps.
+// Within a kind, earlier and tighter matches score higher.
+// It reports false if the query does not match at all.
+func FuzzyScore(query, text string) (int, bool) {
+	query = strings.ToLower(query)
+	text = strings.ToLower(text)
+
+	switch pos := strings.Index(text, query); {
+	case query == "":
+		return 0, true
+	case text == query:
+		return scoreExact, true
+	case pos == 0:
+		return above(scorePrefix-len(text), scoreSubstring), true
+	case pos > 0:
+		return above(scoreSubstring-pos, scoreSubsequence), true
+	}
+
+	// Subsequence match, penalize every character skipped between matches
+	score := scoreSubsequence
+	gap, started := 0, false
+	for _, r := range text {
+		if query == "" {
+			break
+		}
+		q, size := utf8.DecodeRuneInString(query)
+		if r == q {
+			query = query[size:]
+			if started {
+				score -= gap
+			}
+			gap, started = 0, true
+			continue
+		}
+		gap++
+	}
+	if query != "" {
+		return 0, false
+	}
+	return above(score, 0), true
+}
+
+// above keeps the score of a match above floor, the best score of the next worse
+// kind, so that long texts and late matches do not fall into the band below.
+func above(score, floor int) int {
+	if score <= floor {
+		return floor + 1
+	}
+	return score
+}
+
+// searchFields returns the texts of the entry a search query is matched against.
+func (ent TOTPEntry) searchFields() []string {
+	fields := []string{ent.Issuer, ent.AccountName}
+	if ent.Group != "" {
+		fields = append(fields, ent.Group)
+	}
+	return append(fields, ent.Tags...)
+}
+
+// Search returns the entries matching the query, best matches first.
+//
+// Every word of the query must fuzzy match one of the issuer, account name, group
+// or tags of an entry, and the score of an entry is the sum of the best scores of its words.
+// An empty query matches all entries in their stored order.
+func (data *TOTPData) Search(query string) []Match {
+	words := strings.Fields(query)
+	matches := make([]Match, 0, len(data.Entries))
+
+	for ind, ent := range data.Entries {
+		total, ok := 0, true
+		for _, word := range words {
+			best, found := 0, false
+			for _, field := range ent.searchFields() {
+				if score, ok := FuzzyScore(word, field); ok && (!found || score > best) {
+					best, found = score, true
+				}
+			}
+			if !found {
+				ok = false
+				break
+			}
+			total += best
+		}
+		if ok {
+			matches = append(matches, Match{Index: ind, Score: total})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	return matches
+}
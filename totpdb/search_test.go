@@ -0,0 +1,101 @@
+package totpdb
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFuzzyScoreKinds(t *testing.T) {
+	tests := []struct {
+		query, text string
+		min, max    int
+	}{
+		{"github", "GitHub", scoreExact, scoreExact},
+		{"git", "GitHub", scoreSubstring + 1, scorePrefix - 1},
+		{"hub", "GitHub", scoreSubsequence + 1, scoreSubstring - 1},
+		{"gth", "GitHub", 1, scoreSubsequence - 1},
+		// Long texts and late matches stay within the band of their kind
+		{"git", "git" + strings.Repeat("x", 500), scoreSubstring + 1, scorePrefix - 1},
+		{"hub", strings.Repeat("x", 500) + "hub", scoreSubsequence + 1, scoreSubstring - 1},
+		{"gh", "g" + strings.Repeat("x", 500) + "h", 1, scoreSubsequence - 1},
+	}
+	for _, tt := range tests {
+		score, ok := FuzzyScore(tt.query, tt.text)
+		if !ok {
+			t.Errorf("%q in %.20q: no match", tt.query, tt.text)
+			continue
+		}
+		if score < tt.min || score > tt.max {
+			t.Errorf("%q in %.20q: got score %d, want %d to %d", tt.query, tt.text, score, tt.min, tt.max)
+		}
+	}
+	if _, ok := FuzzyScore("bug", "GitHub"); ok {
+		t.Error("got a match for characters out of order")
+	}
+	if score, ok := FuzzyScore("", "GitHub"); !ok || score != 0 {
+		t.Errorf("got %d, %t for the empty query", score, ok)
+	}
+}
+
+func TestFuzzyScoreOrder(t *testing.T) {
+	// Each text ranks above the next one for the query "mail"
+	ranked := []string{
+		"Mail",
+		"Mailbox",
+		"Mailing-list-of-a-very-long-name-that-still-starts-with-the-query" + strings.Repeat("x", 300),
+		"Gmail",
+		"Protonmail",
+		strings.Repeat("x", 400) + "mail",
+		"Mastodon Instance Lab",
+		"M" + strings.Repeat("x", 400) + "ail",
+	}
+	prev := 0
+	for i, text := range ranked {
+		score, ok := FuzzyScore("mail", text)
+		if !ok {
+			t.Fatalf("%.20q: no match", text)
+		}
+		if i > 0 && score >= prev {
+			t.Errorf("%.20q: got score %d, want less than %d of %.20q", text, score, prev, ranked[i-1])
+		}
+		prev = score
+	}
+}
+
+func TestSearch(t *testing.T) {
+	data := &TOTPData{Entries: []TOTPEntry{
+		{Issuer: "Gmail", AccountName: "alice"},
+		{Issuer: "Mail", AccountName: "bob", Tags: []string{"work"}},
+		{Issuer: "GitHub", AccountName: "alice", Group: "work/dev"},
+		{Issuer: "Mailbox", AccountName: "carol"},
+	}}
+	tests := []struct {
+		query string
+		want  []int
+	}{
+		{"", []int{0, 1, 2, 3}},
+		{"mail", []int{1, 3, 0}},
+		{"alice", []int{0, 2}},
+		// Every word must match, tags and groups included
+		{"work alice", []int{2}},
+		{"mail work", []int{1}},
+		{"nothing", nil},
+	}
+	for _, tt := range tests {
+		matches := data.Search(tt.query)
+		got := make([]int, len(matches))
+		for i, m := range matches {
+			got[i] = m.Index
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%q: got entries %v, want %v", tt.query, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%q: got entries %v, want %v", tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+}
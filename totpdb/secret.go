@@ -0,0 +1,66 @@
+package totpdb
+
+// Secret is a buffer for a password or key. Where the platform allows it the
+// memory is locked, so it is never swapped to disk, and it is wiped by Destroy.
+type Secret struct {
+	buf    []byte
+	locked bool
+}
+
+// NewSecret allocates a zeroed secret buffer of the given size.
+func NewSecret(size int) *Secret {
+	if size > 0 {
+		if buf, err := allocLocked(size); err == nil {
+			return &Secret{buf: buf, locked: true}
+		}
+	}
+	// Locking failed, e.g. RLIMIT_MEMLOCK is too low, still wipe on Destroy
+	return &Secret{buf: make([]byte, size)}
+}
+
+// NewSecretFrom moves b into a new secret buffer and wipes b.
+func NewSecretFrom(b []byte) *Secret {
+	s := NewSecret(len(b))
+	copy(s.buf, b)
+	Wipe(b)
+	return s
+}
+
+// Bytes returns the content of the secret. It must not be used after Destroy.
+func (s *Secret) Bytes() []byte {
+	if s == nil {
+		return nil
+	}
+	return s.buf
+}
+
+// Len returns the size of the secret.
+func (s *Secret) Len() int {
+	return len(s.Bytes())
+}
+
+// Destroy wipes the secret and releases its memory.
+func (s *Secret) Destroy() {
+	if s == nil || s.buf == nil {
+		return
+	}
+	Wipe(s.buf)
+	if s.locked {
+		freeLocked(s.buf)
+	}
+	s.buf = nil
+	s.locked = false
+}
+
+// Wipe overwrites b with zeros.
+func Wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// DisableCoreDumps prevents the process from writing core dumps that could
+// contain passwords, keys or decrypted secrets.
+func DisableCoreDumps() error {
+	return disableCoreDumps()
+}
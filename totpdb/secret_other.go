@@ -0,0 +1,20 @@
+//go:build !unix
+
+package totpdb
+
+import "errors"
+
+var errNoLockedMemory = errors.New("locked memory is not supported on this platform")
+
+// allocLocked is not supported, secrets live on the Go heap and are only wiped.
+func allocLocked(size int) ([]byte, error) {
+	return nil, errNoLockedMemory
+}
+
+// freeLocked is never called, as allocLocked always fails.
+func freeLocked(buf []byte) {}
+
+// disableCoreDumps is a no-op, there are no core dumps to disable.
+func disableCoreDumps() error {
+	return nil
+}
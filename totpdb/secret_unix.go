@@ -0,0 +1,29 @@
+//go:build unix
+
+package totpdb
+
+import "golang.org/x/sys/unix"
+
+// allocLocked maps anonymous memory outside of the Go heap and locks it into RAM.
+func allocLocked(size int) ([]byte, error) {
+	buf, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Mlock(buf); err != nil {
+		unix.Munmap(buf)
+		return nil, err
+	}
+	return buf, nil
+}
+
+// freeLocked unlocks and unmaps memory returned by allocLocked.
+func freeLocked(buf []byte) {
+	unix.Munlock(buf)
+	unix.Munmap(buf)
+}
+
+// disableCoreDumps sets the core file size limit to zero.
+func disableCoreDumps() error {
+	return unix.Setrlimit(unix.RLIMIT_CORE, &unix.Rlimit{Cur: 0, Max: 0})
+}
@@ -0,0 +1,120 @@
+package totpdb
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var ErrInvalidTag = errors.New("tags must not be empty or contain spaces or commas")
+
+// NormalizeTag returns the tag in lower case without surrounding spaces.
+func NormalizeTag(tag string) (string, error) {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if tag == "" || strings.ContainsFunc(tag, func(r rune) bool { return r == ',' || unicode.IsSpace(r) }) {
+		return "", ErrInvalidTag
+	}
+	return tag, nil
+}
+
+// NormalizeGroup returns the group with single slashes between its path elements,
+// so that "work//mail/" and "work/mail" name the same group.
+func NormalizeGroup(group string) string {
+	var parts []string
+	for _, p := range strings.Split(group, "/") {
+		if p = strings.TrimSpace(p); p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// HasTag reports whether the entry has the tag, ignoring case.
+func (ent TOTPEntry) HasTag(tag string) bool {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	for _, t := range ent.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// InGroup reports whether the entry is in the group or in one of its subgroups.
+func (ent TOTPEntry) InGroup(group string) bool {
+	group = NormalizeGroup(group)
+	return ent.Group == group || strings.HasPrefix(ent.Group, group+"/")
+}
+
+// addTags returns the tags with the new ones added, sorted and without duplicates.
+func addTags(tags []string, add []string) ([]string, error) {
+	set := make(map[string]bool, len(tags)+len(add))
+	for _, t := range tags {
+		set[t] = true
+	}
+	for _, t := range add {
+		t, err := NormalizeTag(t)
+		if err != nil {
+			return nil, err
+		}
+		set[t] = true
+	}
+	return sortedTags(set), nil
+}
+
+// removeTags returns the tags without the given ones.
+func removeTags(tags []string, remove []string) []string {
+	set := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		set[t] = true
+	}
+	for _, t := range remove {
+		delete(set, strings.ToLower(strings.TrimSpace(t)))
+	}
+	return sortedTags(set)
+}
+
+// sortedTags returns the tags of the set in order, nil if there are none.
+func sortedTags(set map[string]bool) []string {
+	if len(set) == 0 {
+		return nil
+	}
+	tags := make([]string, 0, len(set))
+	for t := range set {
+		tags = append(tags, t)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// TagEntry adds the tags to the entry at index.
+func (data *TOTPData) TagEntry(index int, tags ...string) error {
+	ent := &data.Entries[index]
+	newTags, err := addTags(ent.Tags, tags)
+	if err != nil {
+		return err
+	}
+	ent.Tags = newTags
+	ent.Modified = time.Now()
+	return nil
+}
+
+// UntagEntry removes the tags from the entry at index. Tags the entry does not have are ignored.
+func (data *TOTPData) UntagEntry(index int, tags ...string) {
+	ent := &data.Entries[index]
+	ent.Tags = removeTags(ent.Tags, tags)
+	ent.Modified = time.Now()
+}
+
+// Tags returns all tags in use and the number of entries that have each.
+func (data *TOTPData) Tags() map[string]int {
+	counts := make(map[string]int)
+	for _, ent := range data.Entries {
+		for _, t := range ent.Tags {
+			counts[t]++
+		}
+	}
+	return counts
+}
@@ -0,0 +1,95 @@
+package totpdb
+
+import (
+	"errors"
+	"time"
+)
+
+// DefaultTrashRetention is how long removed entries stay in the trash if
+// TOTPData.TrashRetention is not set.
+const DefaultTrashRetention = 30 * 24 * time.Hour
+
+var ErrNotInTrash = errors.New("TOTP entry not found in trash")
+
+// TrashedEntry is a removed entry kept in the trash, sealed like all entries.
+type TrashedEntry struct {
+	Entry   TOTPEntry `cbor:"entry"`
+	Deleted time.Time `cbor:"deleted"`
+}
+
+// retention returns how long removed entries are kept, a negative duration for ever.
+func (data *TOTPData) retention() time.Duration {
+	if data.TrashRetention == 0 {
+		return DefaultTrashRetention
+	}
+	return data.TrashRetention
+}
+
+// trash moves the entry to the trash, giving it an ID to be restored by if it has none.
+func (data *TOTPData) trash(ent TOTPEntry) error {
+	if ent.ID == "" {
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		ent.ID = id
+	}
+	data.Trash = append(data.Trash, TrashedEntry{Entry: ent, Deleted: time.Now()})
+	return nil
+}
+
+// PurgeAt returns when the trashed entry is purged, the zero time if never.
+func (data *TOTPData) PurgeAt(t TrashedEntry) time.Time {
+	if data.retention() < 0 {
+		return time.Time{}
+	}
+	return t.Deleted.Add(data.retention())
+}
+
+// PurgeTrash deletes the entries that were trashed longer than the retention ago
+// and returns how many it deleted.
+func (data *TOTPData) PurgeTrash(now time.Time) int {
+	kept := data.Trash[:0]
+	for _, t := range data.Trash {
+		if at := data.PurgeAt(t); at.IsZero() || now.Before(at) {
+			kept = append(kept, t)
+		}
+	}
+	purged := len(data.Trash) - len(kept)
+	data.Trash = kept
+	return purged
+}
+
+// FindTrashedByID finds an entry in the trash by its ID or by a unique prefix of it.
+func (data *TOTPData) FindTrashedByID(id string) (int, error) {
+	entries := make([]TOTPEntry, len(data.Trash))
+	for i, t := range data.Trash {
+		entries[i] = t.Entry
+	}
+	ind, err := (&TOTPData{Entries: entries}).FindEntryByID(id)
+	if errors.Is(err, ErrEntryNotFound) {
+		return -1, ErrNotInTrash
+	}
+	return ind, err
+}
+
+// RestoreEntry moves the entry at index of the trash back to the entries.
+// It fails with ErrEntryExists if an entry clashing with it was added since, by the
+// same rule AddEntry and UpdateEntry follow.
+func (data *TOTPData) RestoreEntry(index int) (TOTPEntry, error) {
+	ent := data.Trash[index].Entry
+	if err := data.checkUnique(ent, -1); err != nil {
+		return TOTPEntry{}, err
+	}
+	ent.Modified = time.Now()
+	data.Entries = append(data.Entries, ent)
+	data.Trash = append(data.Trash[:index], data.Trash[index+1:]...)
+	return ent, nil
+}
+
+// EmptyTrash deletes all entries in the trash for good and returns how many it deleted.
+func (data *TOTPData) EmptyTrash() int {
+	n := len(data.Trash)
+	data.Trash = nil
+	return n
+}
@@ -0,0 +1,46 @@
+package totpdb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRestoreEntryClash(t *testing.T) {
+	tests := []struct {
+		name    string
+		trashed TOTPEntry
+		added   TOTPEntry
+		err     error
+	}{
+		{"same issuer", TOTPEntry{Issuer: "ACME", AccountName: "alice"}, TOTPEntry{Issuer: "ACME", AccountName: "alice"}, ErrEntryExists},
+		{"no issuer", TOTPEntry{AccountName: "alice"}, TOTPEntry{Issuer: "ACME", AccountName: "alice"}, ErrEntryExists},
+		{"other issuer", TOTPEntry{Issuer: "Bank", AccountName: "alice"}, TOTPEntry{Issuer: "ACME", AccountName: "alice"}, nil},
+		{"other account", TOTPEntry{Issuer: "ACME", AccountName: "bob"}, TOTPEntry{Issuer: "ACME", AccountName: "alice"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &TOTPData{Entries: []TOTPEntry{tt.trashed}}
+			if err := data.removeAt(0); err != nil {
+				t.Fatal(err)
+			}
+			data.Entries = append(data.Entries, tt.added)
+
+			// Restoring follows the rule of adding
+			if err := data.checkUnique(tt.trashed, -1); !errors.Is(err, tt.err) {
+				t.Errorf("checkUnique gave %v, want %v", err, tt.err)
+			}
+			_, err := data.RestoreEntry(0)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			wantEntries, wantTrash := 2, 0
+			if err != nil {
+				wantEntries, wantTrash = 1, 1
+			}
+			if len(data.Entries) != wantEntries || len(data.Trash) != wantTrash {
+				t.Errorf("got %d entries and %d in the trash, want %d and %d",
+					len(data.Entries), len(data.Trash), wantEntries, wantTrash)
+			}
+		})
+	}
+}
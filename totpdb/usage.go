@@ -0,0 +1,62 @@
+package totpdb
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+)
+
+// usageSuffix is appended to the database file name to get the path of its usage file.
+const usageSuffix = ".used"
+
+// Usage is the last use of the entries by ID, kept next to the database so that
+// generating a code does not rewrite the encrypted database just to record the use.
+// It holds only random IDs and times, nothing that names the accounts.
+type Usage map[string]time.Time
+
+// UsagePath returns the path of the usage file of the database file.
+func UsagePath(filename string) string {
+	return filename + usageSuffix
+}
+
+// ReadUsage reads the usage file of the database file, which may not exist yet.
+func ReadUsage(filename string) (Usage, error) {
+	usage := Usage{}
+	b, err := os.ReadFile(UsagePath(filename))
+	if errors.Is(err, os.ErrNotExist) {
+		return usage, nil
+	}
+	if err != nil {
+		return usage, err
+	}
+	err = json.Unmarshal(b, &usage)
+	return usage, err
+}
+
+// ApplyUsage sets the last use of the entries to the one in usage if that is later.
+func (data *TOTPData) ApplyUsage(usage Usage) {
+	for i, ent := range data.Entries {
+		if used, ok := usage[ent.ID]; ok && used.After(ent.Used) {
+			data.Entries[i].Used = used
+		}
+	}
+}
+
+// RecordUse marks the entry at index as used and writes the last use of all entries
+// to the usage file of the database file, see MarkUsed and ApplyUsage.
+// Entries removed since are left out.
+func (data *TOTPData) RecordUse(filename string, index int) error {
+	data.MarkUsed(index)
+	usage := Usage{}
+	for _, ent := range data.Entries {
+		if ent.ID != "" && !ent.Used.IsZero() {
+			usage[ent.ID] = ent.Used
+		}
+	}
+	b, err := json.Marshal(usage)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(UsagePath(filename), b, 0600)
+}
@@ -0,0 +1,62 @@
+package totpdb
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRecordUse(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "entries.db")
+	earlier := time.Now().Add(-time.Hour).Round(0)
+	data := &TOTPData{Entries: []TOTPEntry{
+		{ID: "1f0c2a9e", Issuer: "ACME", AccountName: "alice"},
+		{ID: "2a0c2a9e", Issuer: "Bank", AccountName: "bob", Used: earlier},
+		{ID: "3b0c2a9e", Issuer: "Shop", AccountName: "carol"},
+	}}
+
+	// No usage file yet
+	usage, err := ReadUsage(filename)
+	if err != nil || len(usage) != 0 {
+		t.Fatalf("got usage %v, %v without a file", usage, err)
+	}
+
+	if err := data.RecordUse(filename, 0); err != nil {
+		t.Fatal(err)
+	}
+	if usage, err = ReadUsage(filename); err != nil {
+		t.Fatal(err)
+	}
+	if len(usage) != 2 || !usage["2a0c2a9e"].Equal(earlier) || !usage["1f0c2a9e"].Equal(data.Entries[0].Used) {
+		t.Errorf("got usage %v", usage)
+	}
+
+	// A later read of the database takes the recorded use, but not an older one
+	stored := &TOTPData{Entries: []TOTPEntry{
+		{ID: "1f0c2a9e"},
+		{ID: "2a0c2a9e", Used: earlier.Add(time.Minute)},
+		{ID: "3b0c2a9e"},
+	}}
+	stored.ApplyUsage(usage)
+	if !stored.Entries[0].Used.Equal(data.Entries[0].Used) {
+		t.Errorf("got last use %s, want the recorded %s", stored.Entries[0].Used, data.Entries[0].Used)
+	}
+	if !stored.Entries[1].Used.Equal(earlier.Add(time.Minute)) {
+		t.Errorf("got last use %s, want the later one of the database", stored.Entries[1].Used)
+	}
+	if !stored.Entries[2].Used.IsZero() {
+		t.Errorf("got last use %s of an unused entry", stored.Entries[2].Used)
+	}
+
+	// Removed entries are dropped from the file on the next use
+	stored.Entries = stored.Entries[1:]
+	if err := stored.RecordUse(filename, 1); err != nil {
+		t.Fatal(err)
+	}
+	if usage, err = ReadUsage(filename); err != nil || len(usage) != 2 {
+		t.Errorf("got usage %v, %v, want the two remaining entries", usage, err)
+	}
+	if _, ok := usage["1f0c2a9e"]; ok {
+		t.Error("removed entry kept in the usage file")
+	}
+}
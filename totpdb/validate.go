@@ -0,0 +1,157 @@
+package totpdb
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pquerna/otp"
+)
+
+// MinSecretBits is the secret length below which secrets are reported as weak,
+// the minimum recommended by RFC 4226.
+const MinSecretBits = 80
+
+var (
+	ErrEmptySecret       = errors.New("secret is empty")
+	ErrWeakSecret        = fmt.Errorf("secret is shorter than %d bits", MinSecretBits)
+	ErrEmptyAccount      = errors.New("account name is empty")
+	ErrNonStandardDigits = errors.New("digits other than 6 or 8 are not supported by most authenticator apps")
+)
+
+// EntryIssue is a problem with the parameters of an entry found by ValidateEntry.
+// Warnings do not keep the entry from being added.
+type EntryIssue struct {
+	Field   string
+	Err     error
+	Warning bool
+}
+
+func (iss EntryIssue) String() string {
+	return fmt.Sprintf("%s: %v", iss.Field, iss.Err)
+}
+
+// ValidationError reports all issues of an entry that are not warnings.
+type ValidationError struct {
+	Issues []EntryIssue
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Issues))
+	for i, iss := range e.Issues {
+		msgs[i] = iss.String()
+	}
+	return "invalid TOTP entry: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the errors of the issues, so that errors.Is finds e.g. ErrInvalidSecret.
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Issues))
+	for i, iss := range e.Issues {
+		errs[i] = iss.Err
+	}
+	return errs
+}
+
+// IssuesError returns a ValidationError of the issues that are not warnings, nil if there are none.
+func IssuesError(issues []EntryIssue) error {
+	var errs []EntryIssue
+	for _, iss := range issues {
+		if !iss.Warning {
+			errs = append(errs, iss)
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Issues: errs}
+}
+
+// ValidateEntry normalizes the secret, type and algorithm of the entry and checks
+// all its parameters. It returns the normalized entry and every issue found.
+func ValidateEntry(ent TOTPEntry) (TOTPEntry, []EntryIssue) {
+	var issues []EntryIssue
+	fail := func(field string, err error) {
+		issues = append(issues, EntryIssue{Field: field, Err: err})
+	}
+	warn := func(field string, err error) {
+		issues = append(issues, EntryIssue{Field: field, Err: err, Warning: true})
+	}
+
+	if strings.TrimSpace(ent.AccountName) == "" {
+		fail("account", ErrEmptyAccount)
+	}
+
+	ent.Secret = NormalizeSecret(ent.Secret)
+	if ent.Secret == "" {
+		fail("secret", ErrEmptySecret)
+	} else if key, err := DecodeSecret(ent.Secret); err != nil {
+		fail("secret", err)
+	} else {
+		if len(key)*8 < MinSecretBits {
+			warn("secret", fmt.Errorf("%w (%d bits)", ErrWeakSecret, len(key)*8))
+		}
+		Wipe(key)
+	}
+
+	ent.Type = strings.ToLower(ent.Type)
+	if ent.Type != TypeTOTP && ent.Type != TypeHOTP {
+		fail("type", fmt.Errorf("%w: %q", ErrUnknownType, ent.Type))
+	}
+
+	if alg, err := ParseAlgorithm(ent.Algorithm); err != nil {
+		fail("algorithm", err)
+	} else if alg == otp.AlgorithmMD5 {
+		fail("algorithm", ErrUnsupportedAlgorithm)
+	} else {
+		ent.Algorithm = alg.String()
+	}
+
+	switch {
+	case ent.Digits < 1 || ent.Digits > 10:
+		fail("digits", fmt.Errorf("%w, not %d", ErrInvalidDigits, ent.Digits))
+	case ent.Digits != 6 && ent.Digits != 8:
+		warn("digits", ErrNonStandardDigits)
+	}
+
+	if ent.Type == TypeTOTP && ent.Period == 0 {
+		fail("period", ErrInvalidPeriod)
+	}
+	return ent, issues
+}
+
+// ValidateKey checks the parameters of the key, see ValidateEntry.
+// Unlike the accessors of otp.Key, which fall back to defaults, it also reports
+// algorithms, digits and periods in the URL that can not be parsed.
+func ValidateKey(k *otp.Key) (TOTPEntry, []EntryIssue) {
+	ent := FromOTPKey(k)
+	q := keyQuery(k)
+	if a := q.Get("algorithm"); a != "" {
+		ent.Algorithm = a
+	}
+	var issues []EntryIssue
+	if d := q.Get("digits"); d != "" {
+		if _, err := strconv.Atoi(d); err != nil {
+			issues = append(issues, EntryIssue{Field: "digits", Err: fmt.Errorf("%w, not %q", ErrInvalidDigits, d)})
+		}
+	}
+	if p := q.Get("period"); p != "" {
+		if _, err := strconv.ParseUint(p, 10, 64); err != nil {
+			issues = append(issues, EntryIssue{Field: "period", Err: fmt.Errorf("%w, not %q", ErrInvalidPeriod, p)})
+		}
+	}
+
+	ent, more := ValidateEntry(ent)
+	return ent, append(issues, more...)
+}
+
+// keyQuery returns the query parameters of the URL of the key.
+func keyQuery(k *otp.Key) url.Values {
+	u, err := url.Parse(k.URL())
+	if err != nil {
+		return url.Values{}
+	}
+	return u.Query()
+}
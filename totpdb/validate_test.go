@@ -0,0 +1,81 @@
+package totpdb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateEntry(t *testing.T) {
+	valid := TOTPEntry{AccountName: "alice", Secret: "JBSWY3DPEHPK3PXP", Type: TypeTOTP,
+		Digits: 6, Period: 30, Algorithm: "SHA1"}
+	tests := []struct {
+		name  string
+		edit  func(*TOTPEntry)
+		field string
+		err   error
+		warn  bool
+	}{
+		{"valid", func(*TOTPEntry) {}, "", nil, false},
+		{"empty account", func(e *TOTPEntry) { e.AccountName = " " }, "account", ErrEmptyAccount, false},
+		{"empty secret", func(e *TOTPEntry) { e.Secret = "" }, "secret", ErrEmptySecret, false},
+		{"invalid secret", func(e *TOTPEntry) { e.Secret = "JBSW1!" }, "secret", ErrInvalidSecret, false},
+		{"weak secret", func(e *TOTPEntry) { e.Secret = "JBSWY3DP" }, "secret", ErrWeakSecret, true},
+		{"unknown type", func(e *TOTPEntry) { e.Type = "motp" }, "type", ErrUnknownType, false},
+		{"unknown algorithm", func(e *TOTPEntry) { e.Algorithm = "SHA3" }, "algorithm", ErrUnknownAlgorithm, false},
+		{"MD5", func(e *TOTPEntry) { e.Algorithm = "md5" }, "algorithm", ErrUnsupportedAlgorithm, false},
+		{"no digits", func(e *TOTPEntry) { e.Digits = 0 }, "digits", ErrInvalidDigits, false},
+		{"too many digits", func(e *TOTPEntry) { e.Digits = 11 }, "digits", ErrInvalidDigits, false},
+		{"odd digits", func(e *TOTPEntry) { e.Digits = 7 }, "digits", ErrNonStandardDigits, true},
+		{"zero period", func(e *TOTPEntry) { e.Period = 0 }, "period", ErrInvalidPeriod, false},
+		{"HOTP without period", func(e *TOTPEntry) { e.Type = TypeHOTP; e.Period = 0 }, "", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ent := valid
+			tt.edit(&ent)
+			_, issues := ValidateEntry(ent)
+			if tt.err == nil {
+				if len(issues) != 0 {
+					t.Errorf("got issues %v, want none", issues)
+				}
+				return
+			}
+			if len(issues) != 1 {
+				t.Fatalf("got issues %v, want one", issues)
+			}
+			iss := issues[0]
+			if iss.Field != tt.field || !errors.Is(iss.Err, tt.err) || iss.Warning != tt.warn {
+				t.Errorf("got issue %+v, want %s: %v with warning %t", iss, tt.field, tt.err, tt.warn)
+			}
+			if err := IssuesError(issues); (err == nil) != tt.warn {
+				t.Errorf("got error %v, want one only for errors", err)
+			} else if err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("got error %v, want it to wrap %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestValidateEntryReportsAll(t *testing.T) {
+	_, issues := ValidateEntry(TOTPEntry{Type: "totp", Algorithm: "MD5", Digits: 12})
+	want := []string{"account", "secret", "algorithm", "digits", "period"}
+	if len(issues) != len(want) {
+		t.Fatalf("got issues %v, want one for each of %v", issues, want)
+	}
+	for i, field := range want {
+		if issues[i].Field != field || issues[i].Warning {
+			t.Errorf("issue %d: got %v, want an error of %s", i, issues[i], field)
+		}
+	}
+}
+
+func TestValidateEntryNormalizes(t *testing.T) {
+	ent, issues := ValidateEntry(TOTPEntry{AccountName: "alice", Secret: "jbsw y3dp-ehpk 3pxp==",
+		Type: "TOTP", Digits: 6, Period: 30, Algorithm: "sha256"})
+	if len(issues) != 0 {
+		t.Fatalf("got issues %v, want none", issues)
+	}
+	if ent.Secret != "JBSWY3DPEHPK3PXP" || ent.Type != TypeTOTP || ent.Algorithm != "SHA256" {
+		t.Errorf("got secret %q, type %q and algorithm %q, want them normalized", ent.Secret, ent.Type, ent.Algorithm)
+	}
+}
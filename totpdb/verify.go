@@ -0,0 +1,106 @@
+package totpdb
+
+import (
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+)
+
+var ErrCodeMismatch = errors.New("code does not match")
+
+// VerifyResult tells which time step or HOTP counter a verified code matched.
+type VerifyResult struct {
+	Valid bool `json:"valid" yaml:"valid"`
+	// Step is the matched time step of TOTP entries, the Unix time divided by the period.
+	Step int64 `json:"step,omitempty" yaml:"step,omitempty"`
+	// Offset is the matched step relative to the step of the verification time.
+	Offset int `json:"offset" yaml:"offset"`
+	// ValidFrom and ValidUntil are the time span of the matched TOTP step.
+	ValidFrom  *time.Time `json:"valid_from,omitempty" yaml:"valid_from,omitempty"`
+	ValidUntil *time.Time `json:"valid_until,omitempty" yaml:"valid_until,omitempty"`
+	// Counter is the matched counter of HOTP entries.
+	Counter uint64 `json:"counter,omitempty" yaml:"counter,omitempty"`
+}
+
+// hotpCode generates the HOTP code of a revealed entry for the counter.
+func (ent TOTPEntry) hotpCode(counter uint64) (string, error) {
+	alg, err := ParseAlgorithm(ent.Algorithm)
+	if err != nil {
+		return "", err
+	}
+	if alg == otp.AlgorithmMD5 {
+		return "", ErrUnsupportedAlgorithm
+	}
+	return hotp.GenerateCodeCustom(ent.Secret, counter, hotp.ValidateOpts{
+		Digits:    otp.Digits(ent.Digits),
+		Algorithm: alg,
+	})
+}
+
+// Verify checks the code against a revealed entry at time t.
+//
+// TOTP codes are checked for the time step of t and for up to window steps
+// before and after it, nearest steps first. HOTP codes are checked for the
+// counter of the entry and up to window counters after it. The entry is not
+// changed, i.e. the HOTP counter is not advanced.
+// A code that does not match gives a result that is not Valid and ErrCodeMismatch.
+func (ent TOTPEntry) Verify(code string, t time.Time, window int) (VerifyResult, error) {
+	if window < 0 {
+		window = 0
+	}
+	match := func(candidate string) bool {
+		return subtle.ConstantTimeCompare([]byte(candidate), []byte(code)) == 1
+	}
+
+	switch ent.Type {
+	case TypeTOTP:
+		period := ent.PeriodDuration()
+		step := t.Unix() / int64(ent.period())
+		for _, offset := range windowOffsets(window) {
+			from := time.Unix((step+int64(offset))*int64(ent.period()), 0)
+			candidate, err := ent.GenerateCode(from)
+			if err != nil {
+				return VerifyResult{}, err
+			}
+			if match(candidate) {
+				until := from.Add(period)
+				return VerifyResult{Valid: true, Step: step + int64(offset), Offset: offset, ValidFrom: &from, ValidUntil: &until}, nil
+			}
+		}
+	case TypeHOTP:
+		for offset := 0; offset <= window; offset++ {
+			candidate, err := ent.hotpCode(ent.Counter + uint64(offset))
+			if err != nil {
+				return VerifyResult{}, err
+			}
+			if match(candidate) {
+				return VerifyResult{Valid: true, Offset: offset, Counter: ent.Counter + uint64(offset)}, nil
+			}
+		}
+	default:
+		return VerifyResult{}, ErrUnsupportedType
+	}
+	return VerifyResult{}, ErrCodeMismatch
+}
+
+// windowOffsets returns the step offsets 0, -1, 1, -2, 2 and so on up to window.
+func windowOffsets(window int) []int {
+	offsets := []int{0}
+	for d := 1; d <= window; d++ {
+		offsets = append(offsets, -d, d)
+	}
+	return offsets
+}
+
+// VerifyCode checks the code against an entry of the database at time t, see TOTPEntry.Verify.
+// Sealed entries are revealed only for the time of the check.
+func (data *TOTPData) VerifyCode(ent TOTPEntry, code string, t time.Time, window int) (VerifyResult, error) {
+	ent, err := data.RevealEntry(ent)
+	if err != nil {
+		return VerifyResult{}, err
+	}
+	return ent.Verify(code, t, window)
+}
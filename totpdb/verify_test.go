@@ -0,0 +1,126 @@
+package totpdb
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// rfc6238Entries are the entries of the test values of RFC 6238, appendix B.
+var rfc6238Entries = map[string]TOTPEntry{
+	"SHA1": {Type: TypeTOTP, Digits: 8, Period: 30, Algorithm: "SHA1",
+		Secret: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"},
+	"SHA256": {Type: TypeTOTP, Digits: 8, Period: 30, Algorithm: "SHA256",
+		Secret: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZA"},
+	"SHA512": {Type: TypeTOTP, Digits: 8, Period: 30, Algorithm: "SHA512",
+		Secret: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNA"},
+}
+
+// TestRFC6238 checks generating and verifying codes against the test values of RFC 6238, appendix B.
+func TestRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		want map[string]string
+	}{
+		{59, map[string]string{"SHA1": "94287082", "SHA256": "46119246", "SHA512": "90693936"}},
+		{1111111109, map[string]string{"SHA1": "07081804", "SHA256": "68084774", "SHA512": "25091201"}},
+		{1111111111, map[string]string{"SHA1": "14050471", "SHA256": "67062674", "SHA512": "99943326"}},
+		{1234567890, map[string]string{"SHA1": "89005924", "SHA256": "91819424", "SHA512": "93441116"}},
+		{2000000000, map[string]string{"SHA1": "69279037", "SHA256": "90698825", "SHA512": "38618901"}},
+		{20000000000, map[string]string{"SHA1": "65353130", "SHA256": "77737706", "SHA512": "47863826"}},
+	}
+	for _, tt := range tests {
+		at := time.Unix(tt.unix, 0)
+		for alg, want := range tt.want {
+			ent := rfc6238Entries[alg]
+			got, err := ent.GenerateCode(at)
+			if err != nil {
+				t.Fatalf("%s at %d: %v", alg, tt.unix, err)
+			}
+			if got != want {
+				t.Errorf("%s at %d: got %s, want %s", alg, tt.unix, got, want)
+			}
+			res, err := ent.Verify(want, at, 0)
+			if err != nil || !res.Valid || res.Step != tt.unix/30 || res.Offset != 0 {
+				t.Errorf("%s at %d: got %+v, %v for the valid code", alg, tt.unix, res, err)
+			}
+		}
+	}
+}
+
+func TestVerifyWindow(t *testing.T) {
+	ent := rfc6238Entries["SHA1"]
+	// 94287082 is the code of step 1, from 30 to 60
+	const code = "94287082"
+	tests := []struct {
+		name   string
+		unix   int64
+		window int
+		offset int
+		valid  bool
+	}{
+		{"last second of the step", 59, 0, 0, true},
+		{"first second of the next step", 60, 0, 0, false},
+		{"previous step within window", 60, 1, -1, true},
+		{"next step within window", 29, 1, 1, true},
+		{"two steps back outside window", 90, 1, 0, false},
+		{"two steps back at window edge", 90, 2, -2, true},
+		{"next step outside window", 29, 0, 0, false},
+		{"three steps back outside window", 120, 2, 0, false},
+		{"negative window acts as zero", 60, -1, 0, false},
+		{"negative window, same step", 45, -1, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := ent.Verify(code, time.Unix(tt.unix, 0), tt.window)
+			if !tt.valid {
+				if !errors.Is(err, ErrCodeMismatch) || res.Valid {
+					t.Errorf("got %+v, %v, want %v", res, err, ErrCodeMismatch)
+				}
+				return
+			}
+			if err != nil || !res.Valid {
+				t.Fatalf("got %+v, %v, want a valid code", res, err)
+			}
+			if res.Offset != tt.offset || res.Step != 1 {
+				t.Errorf("got step %d, offset %d, want step 1, offset %d", res.Step, res.Offset, tt.offset)
+			}
+			if !res.ValidFrom.Equal(time.Unix(30, 0)) || !res.ValidUntil.Equal(time.Unix(60, 0)) {
+				t.Errorf("got valid from %s until %s, want the span of step 1", res.ValidFrom, res.ValidUntil)
+			}
+		})
+	}
+}
+
+func TestVerifyHOTP(t *testing.T) {
+	// RFC 4226, appendix D: counters 0 to 4
+	ent := TOTPEntry{Type: TypeHOTP, Digits: 6, Algorithm: "SHA1", Counter: 1,
+		Secret: "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"}
+	tests := []struct {
+		code    string
+		window  int
+		counter uint64
+		valid   bool
+	}{
+		{"287082", 0, 1, true},
+		{"969429", 2, 3, true},
+		{"338314", 2, 0, false},
+		// Counters behind the stored one are used up
+		{"755224", 3, 0, false},
+	}
+	for _, tt := range tests {
+		res, err := ent.Verify(tt.code, time.Now(), tt.window)
+		if !tt.valid {
+			if !errors.Is(err, ErrCodeMismatch) {
+				t.Errorf("%s with window %d: got %+v, %v, want %v", tt.code, tt.window, res, err, ErrCodeMismatch)
+			}
+			continue
+		}
+		if err != nil || !res.Valid || res.Counter != tt.counter || res.Offset != int(tt.counter-ent.Counter) {
+			t.Errorf("%s with window %d: got %+v, %v, want counter %d", tt.code, tt.window, res, err, tt.counter)
+		}
+	}
+	if ent.Counter != 1 {
+		t.Errorf("verifying advanced the counter to %d", ent.Counter)
+	}
+}